@@ -0,0 +1,74 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import "slices"
+
+//批量查询时使用的map
+type batchSource[K any] interface {
+	find(k K) (int, bool)
+	GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos int) []byte
+	finished() bool
+}
+
+//批量查询的公共部分 先记录各个值在data中的引用，最后统一复制到buf之后
+func getMany[K any, M batchSource[K]](n M, keys []K, dst [][]byte, exist []bool, buf []byte) []byte {
+	if !n.finished() {
+		panic("cant't Get before SetFinished")
+	}
+	if len(dst) < len(keys) || len(exist) < len(keys) {
+		panic("dst or exist is shorter than keys")
+	}
+	size := 0
+	for i, k := range keys {
+		dataBeginPos, ok := n.find(k)
+		exist[i] = ok
+		if !ok {
+			dst[i] = nil
+			continue
+		}
+		dst[i] = n.GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos)
+		size = size + len(dst[i])
+	}
+	return appendValues(buf, dst[:len(keys)], size)
+}
+
+//把dst中data的引用复制到buf之后，size为所有值的总长度，buf的剩余容量不足时只扩容一次
+func appendValues(buf []byte, dst [][]byte, size int) []byte {
+	buf = slices.Grow(buf, size)
+	for i, v := range dst {
+		if len(v) == 0 {
+			dst[i] = nil
+			continue
+		}
+		begin := len(buf)
+		buf = append(buf, v...)
+		dst[i] = buf[begin:len(buf):len(buf)]
+	}
+	return buf
+}
+
+//批量取出数据 dst[i]为keys[i]对应的值，exist[i]表示keys[i]是否存在，dst及exist的长度不能小于keys
+//所有的值追加到buf之后，返回追加后的buf,dst中的值引用返回的buf,相互之间不会影响。
+//buf的剩余容量足够时整批不分配内存，调用方可以在处理完一批之后把返回的buf[:0]用于下一批
+func (n *NoGcStaticMapAny) GetMany(keys [][]byte, dst [][]byte, exist []bool, buf []byte) []byte {
+	return getMany[[]byte](n, keys, dst, exist, buf)
+}
+
+//批量取出数据 用法同NoGcStaticMapAny.GetMany
+func (n *NoGcStaticMapHuge) GetMany(keys [][]byte, dst [][]byte, exist []bool, buf []byte) []byte {
+	return getMany[[]byte](n, keys, dst, exist, buf)
+}
+
+//批量取出数据 用法同NoGcStaticMapAny.GetMany
+func (n *NoGcStaticMapInt) GetMany(keys []int, dst [][]byte, exist []bool, buf []byte) []byte {
+	return getMany[int](n, keys, dst, exist, buf)
+}
+
+//批量取出数据 用法同NoGcStaticMapAny.GetMany
+func (n *NoGcStaticMapUint32) GetMany(keys []uint32, dst [][]byte, exist []bool, buf []byte) []byte {
+	return getMany[uint32](n, keys, dst, exist, buf)
+}
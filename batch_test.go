@@ -0,0 +1,106 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestGetMany(t *testing.T) {
+	m := NewDefaultWithOptions(Options{InMemory: true})
+	mi := NewIntWithOptions(Options{InMemory: true})
+	for i := 0; i < 1000; i += 2 {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		mi.SetString(i, strconv.Itoa(i))
+	}
+	m.SetString("empty", "")
+	m.SetFinished()
+	mi.SetFinished()
+	var keys [][]byte
+	var keysInt []int
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(strconv.Itoa(i)))
+		keysInt = append(keysInt, i)
+	}
+	keys = append(keys, []byte("empty"))
+	dst := make([][]byte, len(keys))
+	exist := make([]bool, len(keys))
+	existInt := make([]bool, len(keysInt))
+	dstInt := make([][]byte, len(keysInt))
+	buf := m.GetMany(keys, dst, exist, nil)
+	mi.GetMany(keysInt, dstInt, existInt, nil)
+	for i := 0; i < 100; i++ {
+		if exist[i] != (i%2 == 0) || existInt[i] != (i%2 == 0) {
+			t.Fatalf("unexpected exist obtained for %d; got %v %v want %v", i, exist[i], existInt[i], i%2 == 0)
+		}
+		want := ""
+		if i%2 == 0 {
+			want = strconv.Itoa(i)
+		}
+		if string(dst[i]) != want || string(dstInt[i]) != want {
+			t.Fatalf("unexpected value obtained; got %q %q want %q", dst[i], dstInt[i], want)
+		}
+	}
+	if !exist[100] || dst[100] != nil {
+		t.Fatalf("unexpected value obtained; got %v %q want true nil", exist[100], dst[100])
+	}
+	//修改一个值不会影响其它的值
+	dst[0] = append(dst[0], 'x')
+	if string(dst[2]) != "2" {
+		t.Fatalf("unexpected value obtained; got %q want %q", dst[2], "2")
+	}
+	//race检测器会引入额外的内存分配
+	if raceEnabled {
+		return
+	}
+	//复用buf时整批不再分配内存
+	if n := testing.AllocsPerRun(100, func() { buf = m.GetMany(keys, dst, exist, buf[:0]) }); n != 0 {
+		t.Fatalf("unexpected allocs obtained; got %v want %v", n, 0)
+	}
+	//没有buf时只分配一次
+	if n := testing.AllocsPerRun(100, func() { m.GetMany(keys, dst, exist, nil) }); n != 1 {
+		t.Fatalf("unexpected allocs obtained; got %v want %v", n, 1)
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	m := NewHugeWithOptions(Options{InMemory: true})
+	mu := NewUint32WithOptions(Options{InMemory: true})
+	for i := 0; i < 1000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		mu.SetString(uint32(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	mu.SetFinished()
+	base := NewDefaultWithOptions(Options{InMemory: true})
+	base.SetFinished()
+	o := NewOverlay(base, Options{InMemory: true})
+	o.SetString("1", "one")
+	buf := []byte("prefix:")
+	buf, exist := m.AppendValue(buf, []byte("12"))
+	if !exist || string(buf) != "prefix:12" {
+		t.Fatalf("unexpected value obtained; got %q want %q", buf, "prefix:12")
+	}
+	buf, exist = mu.AppendValue(buf[:0], 34)
+	if !exist || string(buf) != "34" {
+		t.Fatalf("unexpected value obtained; got %q want %q", buf, "34")
+	}
+	buf, exist = o.AppendValue(buf[:0], []byte("1"))
+	if !exist || string(buf) != "one" {
+		t.Fatalf("unexpected value obtained; got %q want %q", buf, "one")
+	}
+	if buf, exist = m.AppendValue(buf[:0], []byte("not exist")); exist || len(buf) != 0 {
+		t.Fatalf("unexpected value obtained; got %q want nothing", buf)
+	}
+	if raceEnabled {
+		return
+	}
+	//复用buf时不再分配内存
+	if n := testing.AllocsPerRun(100, func() { buf, _ = m.AppendValue(buf[:0], []byte("999")) }); n != 0 {
+		t.Fatalf("unexpected allocs obtained; got %v want %v", n, 0)
+	}
+}
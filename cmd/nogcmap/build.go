@@ -0,0 +1,119 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/yudeguang/noGcStaticMap"
+	"io"
+	"os"
+	"strings"
+)
+
+//从CSV,TSV或者JSON Lines文件构建map并保存为快照文件
+//重复的键，过长的值，无法解析的行等都会带行号报告，有任何错误时不写出快照文件
+func runBuild(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	in := fs.String("in", "", "input file (required)")
+	out := fs.String("out", "", "output snapshot file (required)")
+	format := fs.String("format", "", "input format: csv, tsv or jsonl (default from the extension of -in)")
+	header := fs.Bool("header", true, "the first line of csv/tsv holds column names")
+	key := fs.String("key", "", "key column name or 1-based number for csv/tsv (default 1), key field for jsonl")
+	value := fs.String("value", "", "comma separated value columns or fields (default all other columns for csv/tsv, the whole line for jsonl)")
+	valueSep := fs.String("value-sep", "\t", "separator between multiple csv/tsv value columns")
+	variant := fs.String("variant", "any", "map variant: any, huge, int or uint32")
+	mph := fs.Bool("mph", false, "use a minimal perfect hash index (any and huge only)")
+	offset64 := fs.Bool("offset64", false, "allow data larger than 4GB")
+	duplicate := fs.String("duplicate", "error", "duplicate keys: error, first or last")
+	tmpDir := fs.String("tmpdir", "", "directory for the temporary build file (default os.TempDir())")
+	inMemory := fs.Bool("inmemory", false, "build in memory without a temporary file")
+	maxErrors := fs.Int("max-errors", 100, "stop reporting after this many bad lines (0 for no limit)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *in == "" || *out == "" {
+		fs.Usage()
+		return errors.New("-in and -out are required")
+	}
+
+	inOpt := inputOptions{format: *format, header: *header, key: *key, valueSep: *valueSep}
+	if inOpt.format == "" {
+		inOpt.format = formatFromFileName(*in)
+	}
+	if *value != "" {
+		inOpt.values = strings.Split(*value, ",")
+	}
+	opt := noGcStaticMap.Options{TempDir: *tmpDir, InMemory: *inMemory, Offset64: *offset64}
+	if *mph {
+		opt.Index = noGcStaticMap.IndexMinimalPerfectHash
+	}
+	switch *duplicate {
+	case "error":
+		opt.Duplicate = noGcStaticMap.DuplicateError
+	case "first":
+		opt.Duplicate = noGcStaticMap.DuplicateKeepFirst
+	case "last":
+		opt.Duplicate = noGcStaticMap.DuplicateKeepLast
+	default:
+		return fmt.Errorf("unknown -duplicate %q, want error, first or last", *duplicate)
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := newRecordReader(f, inOpt)
+	if err != nil {
+		return err
+	}
+	b, err := newBuilder(*variant, opt)
+	if err != nil {
+		return err
+	}
+	defer b.close()
+	bad := 0
+	report := func(line int, err error) {
+		bad = bad + 1
+		if *maxErrors == 0 || bad <= *maxErrors {
+			fmt.Fprintf(stderr, "%s:%d: %v\n", *in, line, err)
+		}
+	}
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		var le *lineError
+		if errors.As(err, &le) {
+			report(le.line, le.err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.set(rec.key, rec.value); err != nil {
+			report(rec.line, err)
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d bad lines in %s, %s not written", bad, *in, *out)
+	}
+	if err := b.finish(); err != nil {
+		return err
+	}
+	if err := b.save(*out); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote %d keys to %s\n", b.len(), *out)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"bytes"
+	"github.com/yudeguang/noGcStaticMap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeInput(t *testing.T, name, content string) string {
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write input: %s", err)
+	}
+	return fileName
+}
+
+func TestBuildCSV(t *testing.T) {
+	in := writeInput(t, "data.csv", "id,name,city\n1,\"Smith, John\",Paris\n2,Jane,Berlin\n")
+	out := filepath.Join(t.TempDir(), "data.snapshot")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "-in", in, "-out", out, "-key", "id", "-value", "name,city", "-value-sep", "|", "-variant", "int"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+	m, err := noGcStaticMap.LoadInt(out)
+	if err != nil {
+		t.Fatalf("cannot load snapshot: %s", err)
+	}
+	defer m.Close()
+	if v, _ := m.GetString(1); v != "Smith, John|Paris" {
+		t.Fatalf("unexpected value obtained; got %q want %q", v, "Smith, John|Paris")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("unexpected len; got %d want %d", m.Len(), 2)
+	}
+}
+
+func TestBuildJSONL(t *testing.T) {
+	in := writeInput(t, "data.jsonl", "{\"id\":\"a\",\"n\":1,\"s\":\"x\"}\n\n{\"id\":\"b\",\"n\":2,\"s\":\"y\"}\n")
+	out := filepath.Join(t.TempDir(), "data.snapshot")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "-in", in, "-out", out, "-key", "id", "-value", "s", "-mph"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+	m, err := noGcStaticMap.LoadDefault(out)
+	if err != nil {
+		t.Fatalf("cannot load snapshot: %s", err)
+	}
+	defer m.Close()
+	if v, _ := m.GetString("b"); v != "y" {
+		t.Fatalf("unexpected value obtained; got %q want %q", v, "y")
+	}
+
+	out = filepath.Join(t.TempDir(), "object.snapshot")
+	if code := run([]string{"build", "-in", in, "-out", out, "-key", "id", "-value", "n,s"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+	m, err = noGcStaticMap.LoadDefault(out)
+	if err != nil {
+		t.Fatalf("cannot load snapshot: %s", err)
+	}
+	defer m.Close()
+	if v, _ := m.GetString("a"); v != `{"n":1,"s":"x"}` {
+		t.Fatalf("unexpected value obtained; got %q want %q", v, `{"n":1,"s":"x"}`)
+	}
+}
+
+func TestBuildReportsBadLines(t *testing.T) {
+	in := writeInput(t, "data.tsv", "k\tv\na\t1\nb\t"+strings.Repeat("x", 70000)+"\na\t3\nc\n")
+	out := filepath.Join(t.TempDir(), "data.snapshot")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "-in", in, "-out", out}, &stdout, &stderr); code != 1 {
+		t.Fatalf("unexpected exit code; got %d want %d", code, 1)
+	}
+	for _, want := range []string{":3: k or v is too long", ":4: duplicate key", "2 bad lines"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("missing %q in output %q", want, stderr.String())
+		}
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("snapshot must not be written when there are bad lines")
+	}
+}
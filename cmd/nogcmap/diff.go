@@ -0,0 +1,72 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const diffUsage = `usage: nogcmap diff [flags] <old> <new>
+
+flags:
+`
+
+//比较两个同一类型的快照文件，输出新增，删除以及修改的键的个数，-samples大于0时同时输出部分键
+func runDiff(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, diffUsage)
+		fs.PrintDefaults()
+	}
+	variant := fs.String("variant", "", "map variant of both snapshots: any, huge, int or uint32 (read from the snapshot headers by default)")
+	useMmap := fs.Bool("mmap", true, "open the snapshots with mmap instead of reading them into memory")
+	samples := fs.Int("samples", 10, "print at most this many added, removed and changed keys each")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff takes 2 arguments, got %d", fs.NArg())
+	}
+	oldVariant, err := detectVariant(*variant, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newVariant, err := detectVariant(*variant, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if oldVariant != newVariant {
+		return fmt.Errorf("snapshot variants differ, old is %s and new is %s", oldVariant, newVariant)
+	}
+	d, err := diffFiles(oldVariant, fs.Arg(0), fs.Arg(1), *useMmap, *samples)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "added\t%d\nremoved\t%d\nchanged\t%d\nunchanged\t%d\n", d.added, d.removed, d.changed, d.unchanged)
+	if err != nil {
+		return err
+	}
+	for _, s := range []struct {
+		prefix string
+		keys   []string
+	}{{"+", d.addedKeys}, {"-", d.removedKeys}, {"~", d.changedKeys}} {
+		for _, k := range s.keys {
+			if _, err := fmt.Fprintf(stdout, "%s %s\n", s.prefix, strconv.Quote(k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := buildSnapshot(t, "{\"k\":1,\"v\":\"a\"}\n{\"k\":2,\"v\":\"b\"}\n{\"k\":3,\"v\":\"c\"}\n", "-variant", "int")
+	new := buildSnapshot(t, "{\"k\":2,\"v\":\"b\"}\n{\"k\":3,\"v\":\"C\"}\n{\"k\":4,\"v\":\"d\"}\n", "-variant", "int")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"diff", old, new}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+	want := "added\t1\nremoved\t1\nchanged\t1\nunchanged\t1\n+ \"4\"\n- \"1\"\n~ \"3\"\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected value obtained; got %q want %q", stdout.String(), want)
+	}
+}
+
+//两个快照的类型不同时报错
+func TestDiffVariantMismatch(t *testing.T) {
+	old := buildSnapshot(t, "{\"k\":1,\"v\":\"a\"}\n", "-variant", "int")
+	new := buildSnapshot(t, "{\"k\":1,\"v\":\"a\"}\n", "-variant", "any")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"diff", old, new}, &stdout, &stderr); code == 0 {
+		t.Fatalf("expected diff of an int and an any snapshot to fail")
+	}
+	if !strings.Contains(stderr.String(), "snapshot variants differ, old is int and new is any") {
+		t.Fatalf("unexpected error obtained; got %q", stderr.String())
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//输入文件中的一条键值对
+type record struct {
+	line  int
+	key   string
+	value []byte
+}
+
+//某一行有问题时的错误，报告后继续读取下一行
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+//依次读取输入文件中的键值对，结束时返回io.EOF
+type recordReader interface {
+	next() (record, error)
+}
+
+//读取输入文件时的参数
+type inputOptions struct {
+	format   string   //csv,tsv,jsonl
+	header   bool     //csv,tsv的第一行是否为列名
+	key      string   //键所在的列名或者列号(从1开始),jsonl中为字段名
+	values   []string //值所在的列名或者列号,jsonl中为字段名,为空时csv,tsv为除键以外的所有列,jsonl为整行
+	valueSep string   //有多个值的列时的分隔符
+}
+
+//根据文件扩展名判断格式
+func formatFromFileName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".jsonl", ".ndjson", ".json":
+		return "jsonl"
+	}
+	return "csv"
+}
+
+func newRecordReader(r io.Reader, opt inputOptions) (recordReader, error) {
+	switch opt.format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		return newDelimitedReader(func() (int, []string, error) {
+			fields, err := cr.Read()
+			if err != nil {
+				var pe *csv.ParseError
+				if errors.As(err, &pe) {
+					return pe.Line, nil, &lineError{line: pe.Line, err: pe.Err}
+				}
+				return 0, nil, err
+			}
+			line, _ := cr.FieldPos(0)
+			return line, fields, nil
+		}, opt)
+	case "tsv":
+		s := newLineScanner(r)
+		line := 0
+		return newDelimitedReader(func() (int, []string, error) {
+			if !s.Scan() {
+				if err := s.Err(); err != nil {
+					return 0, nil, err
+				}
+				return 0, nil, io.EOF
+			}
+			line = line + 1
+			return line, strings.Split(strings.TrimSuffix(s.Text(), "\r"), "\t"), nil
+		}, opt)
+	case "jsonl":
+		if opt.key == "" {
+			return nil, errors.New("-key is required for jsonl")
+		}
+		return &jsonlReader{s: newLineScanner(r), opt: opt}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", opt.format)
+}
+
+//按行读取，允许很长的行
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 1<<16), 1<<30)
+	return s
+}
+
+//csv,tsv的读取 read返回行号以及该行的各列
+type delimitedReader struct {
+	read    func() (int, []string, error)
+	opt     inputOptions
+	keyCol  int
+	valCols []int //为nil时为除键以外的所有列
+	names   []string
+}
+
+func newDelimitedReader(read func() (int, []string, error), opt inputOptions) (*delimitedReader, error) {
+	d := &delimitedReader{read: read, opt: opt}
+	if d.opt.key == "" {
+		d.opt.key = "1"
+	}
+	if opt.header {
+		_, names, err := read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("missing header line")
+			}
+			return nil, err
+		}
+		d.names = append([]string(nil), names...)
+	}
+	var err error
+	if d.keyCol, err = d.column(d.opt.key); err != nil {
+		return nil, err
+	}
+	for _, v := range opt.values {
+		c, err := d.column(v)
+		if err != nil {
+			return nil, err
+		}
+		d.valCols = append(d.valCols, c)
+	}
+	return d, nil
+}
+
+//把列名或者从1开始的列号转换为下标
+func (d *delimitedReader) column(spec string) (int, error) {
+	for i, name := range d.names {
+		if name == spec {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(spec); err == nil && n > 0 {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("unknown column %q", spec)
+}
+
+func (d *delimitedReader) next() (record, error) {
+	line, fields, err := d.read()
+	if err != nil {
+		return record{}, err
+	}
+	r := record{line: line}
+	if d.keyCol >= len(fields) {
+		return r, &lineError{line: line, err: fmt.Errorf("missing key column %d", d.keyCol+1)}
+	}
+	r.key = fields[d.keyCol]
+	var value []byte
+	first := true
+	appendValue := func(s string) {
+		if !first {
+			value = append(value, d.opt.valueSep...)
+		}
+		value = append(value, s...)
+		first = false
+	}
+	if d.valCols == nil {
+		for i, f := range fields {
+			if i != d.keyCol {
+				appendValue(f)
+			}
+		}
+	} else {
+		for _, c := range d.valCols {
+			if c >= len(fields) {
+				return r, &lineError{line: line, err: fmt.Errorf("missing value column %d", c+1)}
+			}
+			appendValue(fields[c])
+		}
+	}
+	r.value = value
+	return r, nil
+}
+
+//JSON Lines的读取 每行为一个JSON对象，空行被忽略
+type jsonlReader struct {
+	s    *bufio.Scanner
+	opt  inputOptions
+	line int
+}
+
+func (j *jsonlReader) next() (record, error) {
+	var b []byte
+	for len(b) == 0 {
+		if !j.s.Scan() {
+			if err := j.s.Err(); err != nil {
+				return record{}, err
+			}
+			return record{}, io.EOF
+		}
+		j.line = j.line + 1
+		b = bytes.TrimSpace(j.s.Bytes())
+	}
+	r := record{line: j.line}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return r, &lineError{line: j.line, err: err}
+	}
+	key, ok := fields[j.opt.key]
+	if !ok {
+		return r, &lineError{line: j.line, err: fmt.Errorf("missing key field %q", j.opt.key)}
+	}
+	k, err := jsonKey(key)
+	if err != nil {
+		return r, &lineError{line: j.line, err: err}
+	}
+	r.key = k
+	switch len(j.opt.values) {
+	case 0:
+		r.value = append([]byte(nil), b...)
+	case 1:
+		v, ok := fields[j.opt.values[0]]
+		if !ok {
+			return r, &lineError{line: j.line, err: fmt.Errorf("missing value field %q", j.opt.values[0])}
+		}
+		r.value = jsonValue(v)
+	default:
+		//多个字段时值为只包含这些字段的JSON对象
+		value := []byte{'{'}
+		for i, name := range j.opt.values {
+			v, ok := fields[name]
+			if !ok {
+				return r, &lineError{line: j.line, err: fmt.Errorf("missing value field %q", name)}
+			}
+			if i > 0 {
+				value = append(value, ',')
+			}
+			value = appendJSONString(value, name)
+			value = append(value, ':')
+			value = append(value, v...)
+		}
+		r.value = append(value, '}')
+	}
+	return r, nil
+}
+
+//JSON中的键只能是字符串或者数字，数字保留原来的写法
+func jsonKey(raw json.RawMessage) (string, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	switch k := v.(type) {
+	case string:
+		return k, nil
+	case json.Number:
+		return k.String(), nil
+	}
+	return "", fmt.Errorf("key must be a string or a number, got %s", raw)
+}
+
+//JSON中的字符串取其内容，其它类型保留原来的JSON
+func jsonValue(raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+	return append([]byte(nil), raw...)
+}
+
+//追加JSON格式的字符串
+func appendJSONString(dst []byte, s string) []byte {
+	b, _ := json.Marshal(s)
+	return append(dst, b...)
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+const inspectUsage = `usage: nogcmap inspect <action> [flags] <file> [key]
+
+actions:
+  get      print the value of key
+  dump     print all entries as TSV or JSON Lines
+  stats    print the statistics of the map
+  verify   check that the data and the index are consistent
+
+flags:
+`
+
+var errKeyNotFound = errors.New("key not found")
+
+//查看快照文件 get查询一个键,dump输出所有的键值对,stats输出统计信息,verify检查数据与索引是否一致
+func runInspect(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, inspectUsage)
+		fs.PrintDefaults()
+	}
+	variant := fs.String("variant", "", "map variant: any, huge, int or uint32 (read from the snapshot header by default)")
+	useMmap := fs.Bool("mmap", true, "open the snapshot with mmap instead of reading it into memory")
+	format := fs.String("format", "tsv", "dump format: tsv or jsonl")
+	limit := fs.Int("limit", 0, "dump at most this many entries (0 for all)")
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		fs.Usage()
+		return nil
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	wantArgs := 1
+	switch action {
+	case "get":
+		wantArgs = 2
+	case "dump":
+		if *format != "tsv" && *format != "jsonl" {
+			return fmt.Errorf("unknown -format %q, want tsv or jsonl", *format)
+		}
+	case "stats", "verify":
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if fs.NArg() != wantArgs {
+		fs.Usage()
+		return fmt.Errorf("%s takes %d arguments, got %d", action, wantArgs, fs.NArg())
+	}
+
+	v, err := detectVariant(*variant, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	m, err := openMap(v, fs.Arg(0), *useMmap)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	switch action {
+	case "get":
+		v, exist, err := m.get(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return fmt.Errorf("%w: %s", errKeyNotFound, fs.Arg(1))
+		}
+		_, err = fmt.Fprintf(stdout, "%s\n", v)
+		return err
+	case "dump":
+		return dump(stdout, m, *format, *limit)
+	case "stats":
+		s := m.stats()
+		_, err := fmt.Fprintf(stdout, "len\t%d\ndead\t%d\ndata bytes\t%d\nindex bytes\t%d\ncollisions\t%d\n"+
+			"max key size\t%d\nmax value size\t%d\navg key size\t%.2f\navg value size\t%.2f\n",
+			s.Len, s.Dead, s.DataBytes, s.IndexBytes, s.Collisions, s.MaxKeySize, s.MaxValueSize, s.AvgKeySize, s.AvgValueSize)
+		return err
+	}
+	if err := m.verify(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "ok, %d keys\n", m.stats().Len)
+	return err
+}
+
+//输出所有的键值对 tsv中的制表符，换行符以及反斜杠用反斜杠转义;
+//jsonl中每行为{"key":...,"value":...},不是合法UTF-8的键或者值改为key_base64,value_base64
+func dump(w io.Writer, m *openedMap, format string, limit int) error {
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	count := 0
+	m.rangeKV(func(k string, v []byte) bool {
+		buf = buf[:0]
+		if format == "tsv" {
+			buf = appendTSV(buf, []byte(k))
+			buf = append(buf, '\t')
+			buf = appendTSV(buf, v)
+		} else {
+			buf = append(buf, '{')
+			if m.numericKey {
+				buf = append(buf, `"key":`...)
+				buf = append(buf, k...)
+			} else {
+				buf = appendJSONField(buf, "key", []byte(k))
+			}
+			buf = append(buf, ',')
+			buf = appendJSONField(buf, "value", v)
+			buf = append(buf, '}')
+		}
+		buf = append(buf, '\n')
+		bw.Write(buf)
+		count = count + 1
+		return limit == 0 || count < limit
+	})
+	return bw.Flush()
+}
+
+func appendTSV(dst, b []byte) []byte {
+	for _, c := range b {
+		switch c {
+		case '\t':
+			dst = append(dst, `\t`...)
+		case '\n':
+			dst = append(dst, `\n`...)
+		case '\r':
+			dst = append(dst, `\r`...)
+		case '\\':
+			dst = append(dst, `\\`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+//有效的UTF-8输出为name:"..."，否则输出为name_base64:"..."
+func appendJSONField(dst []byte, name string, b []byte) []byte {
+	if utf8.Valid(b) {
+		dst = appendJSONString(dst, name)
+		dst = append(dst, ':')
+		return appendJSONString(dst, string(b))
+	}
+	dst = appendJSONString(dst, name+"_base64")
+	dst = append(dst, ':', '"')
+	dst = append(dst, base64.StdEncoding.EncodeToString(b)...)
+	return append(dst, '"')
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//用build生成快照文件
+func buildSnapshot(t *testing.T, input string, args ...string) string {
+	in := writeInput(t, "data.jsonl", input)
+	out := filepath.Join(t.TempDir(), "data.snapshot")
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"build", "-in", in, "-out", out, "-key", "k", "-value", "v"}, args...)
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+	return out
+}
+
+func TestInspect(t *testing.T) {
+	snapshot := buildSnapshot(t, "{\"k\":\"a\",\"v\":\"1\\t2\"}\n{\"k\":\"b\",\"v\":\"\\u00e9\"}\n")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"get", snapshot, "b"}, "é\n"},
+		{[]string{"dump", snapshot}, "a\t1\\t2\nb\té\n"},
+		{[]string{"dump", "-format", "jsonl", "-limit", "1", snapshot}, "{\"key\":\"a\",\"value\":\"1\\t2\"}\n"},
+		{[]string{"verify", "-mmap=false", snapshot}, "ok, 2 keys\n"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(append([]string{"inspect"}, tt.args...), &stdout, &stderr); code != 0 {
+			t.Fatalf("unexpected exit code %d for %v: %s", code, tt.args, stderr.String())
+		}
+		if stdout.String() != tt.want {
+			t.Fatalf("unexpected output of %v; got %q want %q", tt.args, stdout.String(), tt.want)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"inspect", "stats", snapshot}, &stdout, &stderr); code != 0 || !strings.HasPrefix(stdout.String(), "len\t2\n") {
+		t.Fatalf("unexpected stats; got %q (exit code %d)", stdout.String(), code)
+	}
+	if code := run([]string{"inspect", "get", snapshot, "c"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "key not found") {
+		t.Fatalf("unexpected result for missing key; got exit code %d, %q", code, stderr.String())
+	}
+}
+
+func TestInspectIntKeys(t *testing.T) {
+	snapshot := buildSnapshot(t, "{\"k\":7,\"v\":\"x\"}\n", "-variant", "uint32")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"inspect", "dump", "-format", "jsonl", snapshot}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+	if want := "{\"key\":7,\"value\":\"x\"}\n"; stdout.String() != want {
+		t.Fatalf("unexpected value obtained; got %q want %q", stdout.String(), want)
+	}
+}
+
+func TestInspectVerifyCorrupted(t *testing.T) {
+	snapshot := buildSnapshot(t, "{\"k\":\"a\",\"v\":\"1\"}\n{\"k\":\"b\",\"v\":\"2\"}\n")
+	b, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatalf("cannot read snapshot: %s", err)
+	}
+	//文件头之后第一个键值对的值
+	b[56+5] = 'x'
+	if err := os.WriteFile(snapshot, b, 0644); err != nil {
+		t.Fatalf("cannot write snapshot: %s", err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"inspect", "verify", snapshot}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "checksum mismatch") {
+		t.Fatalf("unexpected result for corrupted snapshot; got exit code %d, %q", code, stderr.String())
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+
+//nogcmap 构建及查看noGcStaticMap快照文件的命令行工具
+//
+//用法:
+//
+//	nogcmap build -in data.csv -out data.snapshot -key id -value name [-variant any|huge|int|uint32]
+//	nogcmap inspect get|dump|stats|verify [-variant any|huge|int|uint32] data.snapshot [key]
+//	nogcmap diff [-variant any|huge|int|uint32] [-samples 10] old.snapshot new.snapshot
+//
+//inspect及diff未指定-variant时从快照文件头中读取map类型
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: nogcmap <command> [flags]
+
+commands:
+  build    build a snapshot file from CSV, TSV or JSON Lines
+  inspect  look up a key, dump, print stats or verify a snapshot file
+  diff     count added, removed and changed keys between two snapshot files
+
+run "nogcmap <command> -h" for the flags of each command
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+//执行子命令，返回进程的退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "build":
+		err = runBuild(args[1:], stdout, stderr)
+	case "inspect":
+		err = runInspect(args[1:], stdout, stderr)
+	case "diff":
+		err = runDiff(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "nogcmap: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "nogcmap %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,271 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package main
+
+import (
+	"fmt"
+	"github.com/yudeguang/noGcStaticMap"
+	"strconv"
+)
+
+//各种map类型的构建器，键统一为文本，由各类型自行解析
+type builder struct {
+	set    func(k string, v []byte) error
+	finish func() error
+	save   func(fileName string) error
+	close  func() error //未完成时放弃构建并删除临时文件，完成后释放数据
+	len    func() int
+}
+
+func newBuilder(variant string, opt noGcStaticMap.Options) (*builder, error) {
+	switch variant {
+	case "any":
+		m, err := noGcStaticMap.TryNewDefaultWithOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return &builder{
+			set:    func(k string, v []byte) error { return m.TrySet([]byte(k), v) },
+			finish: m.Finish, save: m.SaveToFile, close: m.Close, len: m.Len,
+		}, nil
+	case "huge":
+		m, err := noGcStaticMap.TryNewHugeWithOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return &builder{
+			set:    func(k string, v []byte) error { return m.TrySet([]byte(k), v) },
+			finish: m.Finish, save: m.SaveToFile, close: m.Close, len: m.Len,
+		}, nil
+	case "int":
+		m, err := noGcStaticMap.TryNewIntWithOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return &builder{
+			set: func(k string, v []byte) error {
+				i, err := parseIntKey(k)
+				if err != nil {
+					return err
+				}
+				return m.TrySet(i, v)
+			},
+			finish: m.Finish, save: m.SaveToFile, close: m.Close, len: m.Len,
+		}, nil
+	case "uint32":
+		m, err := noGcStaticMap.TryNewUint32WithOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return &builder{
+			set: func(k string, v []byte) error {
+				i, err := parseUint32Key(k)
+				if err != nil {
+					return err
+				}
+				return m.TrySet(i, v)
+			},
+			finish: m.Finish, save: m.SaveToFile, close: m.Close, len: m.Len,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown variant %q, want any, huge, int or uint32", variant)
+}
+
+//variant为空时从快照文件头中读取map类型
+func detectVariant(variant, fileName string) (string, error) {
+	if variant != "" {
+		return variant, nil
+	}
+	info, err := noGcStaticMap.ReadSnapshotInfo(fileName)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fileName, err)
+	}
+	return info.Kind, nil
+}
+
+func parseIntKey(k string) (int, error) {
+	i, err := strconv.Atoi(k)
+	if err != nil {
+		return 0, fmt.Errorf("invalid int key %q", k)
+	}
+	return i, nil
+}
+
+func parseUint32Key(k string) (uint32, error) {
+	i, err := strconv.ParseUint(k, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uint32 key %q", k)
+	}
+	return uint32(i), nil
+}
+
+//打开的快照文件，键统一为文本
+type openedMap struct {
+	numericKey bool //整型类型的键，输出JSON时为数字
+	get        func(k string) (v []byte, exist bool, err error)
+	rangeKV    func(fn func(k string, v []byte) bool)
+	stats      func() noGcStaticMap.Stats
+	verify     func() error
+	close      func() error
+}
+
+//按variant打开快照文件 useMmap为true时以mmap的方式只读打开
+func openMap(variant, fileName string, useMmap bool) (*openedMap, error) {
+	switch variant {
+	case "any":
+		load := noGcStaticMap.LoadDefault
+		if useMmap {
+			load = noGcStaticMap.LoadDefaultMmap
+		}
+		m, err := load(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return &openedMap{
+			get: func(k string) ([]byte, bool, error) {
+				v, exist := m.GetUnsafe([]byte(k))
+				return v, exist, nil
+			},
+			rangeKV: func(fn func(k string, v []byte) bool) {
+				m.Range(func(k, v []byte) bool { return fn(string(k), v) })
+			},
+			stats: m.Stats, verify: m.Verify, close: m.Close,
+		}, nil
+	case "huge":
+		load := noGcStaticMap.LoadHuge
+		if useMmap {
+			load = noGcStaticMap.LoadHugeMmap
+		}
+		m, err := load(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return &openedMap{
+			get: func(k string) ([]byte, bool, error) {
+				v, exist := m.GetUnsafe([]byte(k))
+				return v, exist, nil
+			},
+			rangeKV: func(fn func(k string, v []byte) bool) {
+				m.Range(func(k, v []byte) bool { return fn(string(k), v) })
+			},
+			stats: m.Stats, verify: m.Verify, close: m.Close,
+		}, nil
+	case "int":
+		load := noGcStaticMap.LoadInt
+		if useMmap {
+			load = noGcStaticMap.LoadIntMmap
+		}
+		m, err := load(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return &openedMap{
+			numericKey: true,
+			get: func(k string) ([]byte, bool, error) {
+				i, err := parseIntKey(k)
+				if err != nil {
+					return nil, false, err
+				}
+				v, exist := m.GetUnsafe(i)
+				return v, exist, nil
+			},
+			rangeKV: func(fn func(k string, v []byte) bool) {
+				m.Range(func(k int, v []byte) bool { return fn(strconv.Itoa(k), v) })
+			},
+			stats: m.Stats, verify: m.Verify, close: m.Close,
+		}, nil
+	case "uint32":
+		load := noGcStaticMap.LoadUint32
+		if useMmap {
+			load = noGcStaticMap.LoadUint32Mmap
+		}
+		m, err := load(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return &openedMap{
+			numericKey: true,
+			get: func(k string) ([]byte, bool, error) {
+				i, err := parseUint32Key(k)
+				if err != nil {
+					return nil, false, err
+				}
+				v, exist := m.GetUnsafe(i)
+				return v, exist, nil
+			},
+			rangeKV: func(fn func(k string, v []byte) bool) {
+				m.Range(func(k uint32, v []byte) bool { return fn(strconv.FormatUint(uint64(k), 10), v) })
+			},
+			stats: m.Stats, verify: m.Verify, close: m.Close,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown variant %q, want any, huge, int or uint32", variant)
+}
+
+//两个快照文件之间的差异，键统一为文本
+type diffSummary struct {
+	added, removed, changed, unchanged  int
+	addedKeys, removedKeys, changedKeys []string
+}
+
+//按variant打开两个快照文件并比较
+func diffFiles(variant, oldFile, newFile string, useMmap bool, samples int) (diffSummary, error) {
+	opt := noGcStaticMap.DiffOptions{Samples: samples}
+	switch variant {
+	case "any":
+		load := noGcStaticMap.LoadDefault
+		if useMmap {
+			load = noGcStaticMap.LoadDefaultMmap
+		}
+		return diffSnapshots(load, noGcStaticMap.Diff, func(k []byte) string { return string(k) }, oldFile, newFile, opt)
+	case "huge":
+		load := noGcStaticMap.LoadHuge
+		if useMmap {
+			load = noGcStaticMap.LoadHugeMmap
+		}
+		return diffSnapshots(load, noGcStaticMap.DiffHuge, func(k []byte) string { return string(k) }, oldFile, newFile, opt)
+	case "int":
+		load := noGcStaticMap.LoadInt
+		if useMmap {
+			load = noGcStaticMap.LoadIntMmap
+		}
+		return diffSnapshots(load, noGcStaticMap.DiffInt, strconv.Itoa, oldFile, newFile, opt)
+	case "uint32":
+		load := noGcStaticMap.LoadUint32
+		if useMmap {
+			load = noGcStaticMap.LoadUint32Mmap
+		}
+		return diffSnapshots(load, noGcStaticMap.DiffUint32, func(k uint32) string { return strconv.FormatUint(uint64(k), 10) }, oldFile, newFile, opt)
+	}
+	return diffSummary{}, fmt.Errorf("unknown variant %q, want any, huge, int or uint32", variant)
+}
+
+func diffSnapshots[K any, M interface{ Close() error }](load func(string) (M, error), diff func(old, new M, opt noGcStaticMap.DiffOptions) (noGcStaticMap.DiffResult[K], error),
+	format func(K) string, oldFile, newFile string, opt noGcStaticMap.DiffOptions) (diffSummary, error) {
+	old, err := load(oldFile)
+	if err != nil {
+		return diffSummary{}, err
+	}
+	defer old.Close()
+	new, err := load(newFile)
+	if err != nil {
+		return diffSummary{}, err
+	}
+	defer new.Close()
+	d, err := diff(old, new, opt)
+	if err != nil {
+		return diffSummary{}, err
+	}
+	formatKeys := func(keys []K) []string {
+		s := make([]string, len(keys))
+		for i, k := range keys {
+			s[i] = format(k)
+		}
+		return s
+	}
+	return diffSummary{added: d.Added, removed: d.Removed, changed: d.Changed, unchanged: d.Unchanged,
+		addedKeys: formatKeys(d.AddedKeys), removedKeys: formatKeys(d.RemovedKeys), changedKeys: formatKeys(d.ChangedKeys)}, nil
+}
@@ -0,0 +1,364 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"github.com/cespare/xxhash"
+	"math"
+	"runtime"
+	"sync"
+)
+
+var errConcurrentStorage = errors.New("Options.Storage can't be shared by shards of concurrent builder")
+
+//结束构建后的结果，用于构建静态索引以及合并并发构建时的各个分片
+type buildResult struct {
+	data  []byte
+	keys  []uint64 //默认类型及Huge类型中为键的hash值,整型类型中为键本身
+	poses []uint64 //键值对在data中的位置
+	len   int
+	dead  int
+}
+
+//并发构建时的分片，每个分片是一个独立的map
+type buildShard interface {
+	Abort() error
+	Close() error
+	finishBuild() (buildResult, error)
+}
+
+//加锁的分片
+type lockedShard[M buildShard] struct {
+	sync.Mutex
+	m M
+	_ [48]byte //避免相邻的分片处于同一个缓存行
+}
+
+//并发构建的公共部分 按键的hash值所在的分区(h % 512)把键值对分配到各个分片，各分片分别加锁，Finish时合并为一个map
+type concurrentBuilder[K any, M buildShard] struct {
+	shards   []lockedShard[M]
+	hash     func(k K) uint64
+	set      func(m M, k K, h uint64, v []byte) error
+	offset64 bool
+	finished bool
+}
+
+//分片数 为不超过512的2的幂，同一个分区中的键总是在同一个分片中
+func shardCount() int {
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) && n < 512 {
+		n = n * 2
+	}
+	return n
+}
+
+func newConcurrentBuilder[K any, M buildShard](opt Options, newShard func(Options) (M, error), hash func(K) uint64, set func(M, K, uint64, []byte) error) (*concurrentBuilder[K, M], error) {
+	if opt.Storage != nil {
+		return nil, errConcurrentStorage
+	}
+	b := &concurrentBuilder[K, M]{hash: hash, set: set, offset64: opt.Offset64}
+	b.shards = make([]lockedShard[M], shardCount())
+	for i := range b.shards {
+		m, err := newShard(opt)
+		if err != nil {
+			//创建临时文件失败时删除已经创建的临时文件
+			for j := 0; j < i; j++ {
+				b.shards[j].m.Abort()
+			}
+			return nil, err
+		}
+		b.shards[i].m = m
+	}
+	return b, nil
+}
+
+//增加数据，可以在多个goroutine中同时调用
+func (b *concurrentBuilder[K, M]) trySet(k K, v []byte) error {
+	h := b.hash(k)
+	s := &b.shards[h%512%uint64(len(b.shards))]
+	s.Lock()
+	err := b.set(s.m, k, h, v)
+	s.Unlock()
+	return err
+}
+
+//结束所有分片的构建，各分片并行读入数据后按分片的顺序合并
+func (b *concurrentBuilder[K, M]) finish() (buildResult, error) {
+	if b.finished {
+		return buildResult{}, ErrFinished
+	}
+	b.finished = true
+	results := make([]buildResult, len(b.shards))
+	errs := make([]error, len(b.shards))
+	var wg sync.WaitGroup
+	for i := range b.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := &b.shards[i]
+			s.Lock()
+			defer s.Unlock()
+			results[i], errs[i] = s.m.finishBuild()
+			//数据已经交给results,分片本身不再引用;finishBuild出错时分片已经放弃构建并删除了临时文件
+			s.m.Close()
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return buildResult{}, err
+	}
+	var r buildResult
+	size := 0
+	for i := range results {
+		size = size + len(results[i].data)
+		r.len = r.len + results[i].len
+		r.dead = r.dead + results[i].dead
+	}
+	//索引中的位置默认只占4个字节，合并后data超过4G时无法表示
+	if !b.offset64 && uint64(size) > math.MaxUint32 {
+		return buildResult{}, ErrDataTooLarge
+	}
+	r.data = make([]byte, 0, size)
+	r.keys = make([]uint64, 0, r.len)
+	r.poses = make([]uint64, 0, r.len)
+	for i := range results {
+		base := uint64(len(r.data))
+		r.data = append(r.data, results[i].data...)
+		r.keys = append(r.keys, results[i].keys...)
+		for _, dataBeginPos := range results[i].poses {
+			r.poses = append(r.poses, base+dataBeginPos)
+		}
+		//尽早释放分片的数据
+		results[i] = buildResult{}
+	}
+	return r, nil
+}
+
+//放弃所有分片的构建并删除临时文件
+func (b *concurrentBuilder[K, M]) abort() error {
+	if b.finished {
+		return ErrFinished
+	}
+	errs := make([]error, len(b.shards))
+	for i := range b.shards {
+		s := &b.shards[i]
+		s.Lock()
+		errs[i] = s.m.Abort()
+		s.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+//并发构建默认类型的map,可以在多个goroutine中同时Set,Finish时合并为一个NoGcStaticMapAny
+//注意:
+//1)合并后Range的顺序不再是Set的顺序;
+//2)在不同的goroutine中Set相同的键时，DuplicateKeepFirst,DuplicateKeepLast保留哪一个值取决于实际执行的先后;
+//3)合并时需要同时持有各分片的数据及合并后的数据，内存占用的峰值约为data的2倍
+type ConcurrentBuilderAny struct {
+	b   *concurrentBuilder[[]byte, *NoGcStaticMapAny]
+	opt Options
+}
+
+//初始化 每个分片使用一个临时文件,opt.Storage无法在多个分片中共用，不能使用
+func NewConcurrentDefault(opt Options) *ConcurrentBuilderAny {
+	c, err := TryNewConcurrentDefault(opt)
+	haserrPanic(err)
+	return c
+}
+
+//初始化 创建临时文件失败或者使用了opt.Storage时返回错误而不是panic
+func TryNewConcurrentDefault(opt Options) (*ConcurrentBuilderAny, error) {
+	b, err := newConcurrentBuilder(opt, TryNewDefaultWithOptions, xxhash.Sum64, (*NoGcStaticMapAny).trySet)
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrentBuilderAny{b: b, opt: opt}, nil
+}
+
+//增加数据，可以在多个goroutine中同时调用
+func (c *ConcurrentBuilderAny) Set(k, v []byte) {
+	if err := c.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加数据,出错时返回*KeyError而不是panic
+func (c *ConcurrentBuilderAny) TrySet(k, v []byte) error {
+	return c.b.trySet(k, v)
+}
+
+//完成存储并合并为一个map,必须在所有的Set都返回之后调用
+func (c *ConcurrentBuilderAny) Finish() (*NoGcStaticMapAny, error) {
+	r, err := c.b.finish()
+	if err != nil {
+		return nil, err
+	}
+	n := &NoGcStaticMapAny{setFinished: true, offset64: c.opt.Offset64, dataBeginPos: len(r.data), len: r.len, dead: r.dead,
+		duplicate: c.opt.Duplicate, data: r.data, hashIndex: hashIndex{indexType: c.opt.Index}}
+	n.hashIndex.build(r.keys, r.poses, n.offset64)
+	return n, nil
+}
+
+//放弃构建并删除所有的临时文件
+func (c *ConcurrentBuilderAny) Abort() error {
+	return c.b.abort()
+}
+
+//并发构建Huge类型的map,可以在多个goroutine中同时Set,Finish时合并为一个NoGcStaticMapHuge,注意事项同ConcurrentBuilderAny
+type ConcurrentBuilderHuge struct {
+	b   *concurrentBuilder[[]byte, *NoGcStaticMapHuge]
+	opt Options
+}
+
+//初始化 每个分片使用一个临时文件,opt.Storage无法在多个分片中共用，不能使用
+func NewConcurrentHuge(opt Options) *ConcurrentBuilderHuge {
+	c, err := TryNewConcurrentHuge(opt)
+	haserrPanic(err)
+	return c
+}
+
+//初始化 创建临时文件失败或者使用了opt.Storage时返回错误而不是panic
+func TryNewConcurrentHuge(opt Options) (*ConcurrentBuilderHuge, error) {
+	b, err := newConcurrentBuilder(opt, TryNewHugeWithOptions, xxhash.Sum64, (*NoGcStaticMapHuge).trySet)
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrentBuilderHuge{b: b, opt: opt}, nil
+}
+
+//增加数据，可以在多个goroutine中同时调用
+func (c *ConcurrentBuilderHuge) Set(k, v []byte) {
+	if err := c.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加数据,出错时返回*KeyError而不是panic
+func (c *ConcurrentBuilderHuge) TrySet(k, v []byte) error {
+	return c.b.trySet(k, v)
+}
+
+//完成存储并合并为一个map,必须在所有的Set都返回之后调用
+func (c *ConcurrentBuilderHuge) Finish() (*NoGcStaticMapHuge, error) {
+	r, err := c.b.finish()
+	if err != nil {
+		return nil, err
+	}
+	n := &NoGcStaticMapHuge{setFinished: true, offset64: c.opt.Offset64, dataBeginPos: len(r.data), len: r.len, dead: r.dead,
+		duplicate: c.opt.Duplicate, data: r.data, hashIndex: hashIndex{indexType: c.opt.Index}}
+	n.hashIndex.build(r.keys, r.poses, n.offset64)
+	return n, nil
+}
+
+//放弃构建并删除所有的临时文件
+func (c *ConcurrentBuilderHuge) Abort() error {
+	return c.b.abort()
+}
+
+//并发构建int类型的map,可以在多个goroutine中同时Set,Finish时合并为一个NoGcStaticMapInt,注意事项同ConcurrentBuilderAny
+type ConcurrentBuilderInt struct {
+	b   *concurrentBuilder[int, *NoGcStaticMapInt]
+	opt Options
+}
+
+//初始化 每个分片使用一个临时文件,opt.Storage无法在多个分片中共用，不能使用
+func NewConcurrentInt(opt Options) *ConcurrentBuilderInt {
+	c, err := TryNewConcurrentInt(opt)
+	haserrPanic(err)
+	return c
+}
+
+//初始化 创建临时文件失败或者使用了opt.Storage时返回错误而不是panic
+func TryNewConcurrentInt(opt Options) (*ConcurrentBuilderInt, error) {
+	b, err := newConcurrentBuilder(opt, TryNewIntWithOptions, func(k int) uint64 { return uint64(k) },
+		func(m *NoGcStaticMapInt, k int, _ uint64, v []byte) error { return m.TrySet(k, v) })
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrentBuilderInt{b: b, opt: opt}, nil
+}
+
+//增加数据，可以在多个goroutine中同时调用
+func (c *ConcurrentBuilderInt) Set(k int, v []byte) {
+	if err := c.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加数据,出错时返回*KeyError而不是panic
+func (c *ConcurrentBuilderInt) TrySet(k int, v []byte) error {
+	return c.b.trySet(k, v)
+}
+
+//完成存储并合并为一个map,必须在所有的Set都返回之后调用
+func (c *ConcurrentBuilderInt) Finish() (*NoGcStaticMapInt, error) {
+	r, err := c.b.finish()
+	if err != nil {
+		return nil, err
+	}
+	n := &NoGcStaticMapInt{setFinished: true, offset64: c.opt.Offset64, dataBeginPos: len(r.data), len: r.len, dead: r.dead,
+		duplicate: c.opt.Duplicate, data: r.data}
+	n.buildIndex(r.keys, r.poses)
+	return n, nil
+}
+
+//放弃构建并删除所有的临时文件
+func (c *ConcurrentBuilderInt) Abort() error {
+	return c.b.abort()
+}
+
+//并发构建uint32类型的map,可以在多个goroutine中同时Set,Finish时合并为一个NoGcStaticMapUint32,注意事项同ConcurrentBuilderAny
+type ConcurrentBuilderUint32 struct {
+	b   *concurrentBuilder[uint32, *NoGcStaticMapUint32]
+	opt Options
+}
+
+//初始化 每个分片使用一个临时文件,opt.Storage无法在多个分片中共用，不能使用
+func NewConcurrentUint32(opt Options) *ConcurrentBuilderUint32 {
+	c, err := TryNewConcurrentUint32(opt)
+	haserrPanic(err)
+	return c
+}
+
+//初始化 创建临时文件失败或者使用了opt.Storage时返回错误而不是panic
+func TryNewConcurrentUint32(opt Options) (*ConcurrentBuilderUint32, error) {
+	b, err := newConcurrentBuilder(opt, TryNewUint32WithOptions, func(k uint32) uint64 { return uint64(k) },
+		func(m *NoGcStaticMapUint32, k uint32, _ uint64, v []byte) error { return m.TrySet(k, v) })
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrentBuilderUint32{b: b, opt: opt}, nil
+}
+
+//增加数据，可以在多个goroutine中同时调用
+func (c *ConcurrentBuilderUint32) Set(k uint32, v []byte) {
+	if err := c.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加数据,出错时返回*KeyError而不是panic
+func (c *ConcurrentBuilderUint32) TrySet(k uint32, v []byte) error {
+	return c.b.trySet(k, v)
+}
+
+//完成存储并合并为一个map,必须在所有的Set都返回之后调用
+func (c *ConcurrentBuilderUint32) Finish() (*NoGcStaticMapUint32, error) {
+	r, err := c.b.finish()
+	if err != nil {
+		return nil, err
+	}
+	n := &NoGcStaticMapUint32{setFinished: true, offset64: c.opt.Offset64, dataBeginPos: len(r.data), len: r.len, dead: r.dead,
+		duplicate: c.opt.Duplicate, data: r.data}
+	n.buildIndex(r.keys, r.poses)
+	return n, nil
+}
+
+//放弃构建并删除所有的临时文件
+func (c *ConcurrentBuilderUint32) Abort() error {
+	return c.b.abort()
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentBuilder(t *testing.T) {
+	dir := t.TempDir()
+	for _, index := range []IndexType{IndexOpenAddressing, IndexMinimalPerfectHash} {
+		b := NewConcurrentDefault(Options{TempDir: dir, Index: index})
+		bi := NewConcurrentInt(Options{TempDir: dir})
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := g; i < 100000; i += 8 {
+					b.Set([]byte(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+					bi.Set(i, []byte(strconv.Itoa(i)))
+				}
+			}(g)
+		}
+		wg.Wait()
+		//其它goroutine中写入的键也能检测出重复
+		if err := b.TrySet([]byte("12345"), nil); !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrDuplicateKey)
+		}
+		m, err := b.Finish()
+		if err != nil {
+			t.Fatalf("unexpected error obtained; got %v want nil", err)
+		}
+		mi, err := bi.Finish()
+		if err != nil {
+			t.Fatalf("unexpected error obtained; got %v want nil", err)
+		}
+		if m.Len() != 100000 || mi.Len() != 100000 {
+			t.Fatalf("unexpected len obtained; got %v %v want %v", m.Len(), mi.Len(), 100000)
+		}
+		for i := 0; i < 100000; i++ {
+			if val, _ := m.GetString(strconv.Itoa(i)); val != strconv.Itoa(i) {
+				t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+			}
+			if val, _ := mi.GetString(i); val != strconv.Itoa(i) {
+				t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+			}
+		}
+		count := 0
+		m.Range(func(k, v []byte) bool {
+			count++
+			return true
+		})
+		if count != 100000 {
+			t.Fatalf("unexpected range count obtained; got %d want %d", count, 100000)
+		}
+		if _, err = b.Finish(); !errors.Is(err, ErrFinished) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrFinished)
+		}
+	}
+	//所有分片的临时文件都已删除
+	b := NewConcurrentUint32(Options{TempDir: dir})
+	b.Set(1, []byte("1"))
+	if err := b.Abort(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("unexpected temp file count obtained; got %d want %d", len(entries), 0)
+	}
+}
+
+//Set与NoGcStaticMapAny.Set一样以*KeyError作为panic的值
+func TestConcurrentBuilderSetPanicValue(t *testing.T) {
+	b := NewConcurrentDefault(Options{InMemory: true})
+	defer b.Abort()
+	b.Set([]byte("1"), nil)
+	defer func() {
+		if _, ok := recover().(*KeyError); !ok {
+			t.Fatalf("expected *KeyError as panic value")
+		}
+	}()
+	b.Set([]byte("1"), nil)
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import "bytes"
+
+//比较两个map时的参数
+type DiffOptions struct {
+	Samples int //新增，删除，修改的键各自最多记录的个数，为0时只统计个数
+}
+
+//两个map之间的差异
+type DiffResult[K any] struct {
+	Added       int //只在新的map中存在的键的个数
+	Removed     int //只在旧的map中存在的键的个数
+	Changed     int //两个map中都存在但值不同的键的个数
+	Unchanged   int //两个map中都存在且值相同的键的个数
+	AddedKeys   []K //新增的键，最多DiffOptions.Samples个,[]byte类型的键为复制品
+	RemovedKeys []K //删除的键
+	ChangedKeys []K //值被修改的键
+}
+
+//两个map是否完全相同
+func (d *DiffResult[K]) Equal() bool {
+	return d.Added == 0 && d.Removed == 0 && d.Changed == 0
+}
+
+//记录一个键 []byte类型的键是data中的引用，需要复制
+func (d *DiffResult[K]) sample(keys *[]K, k K, opt DiffOptions) {
+	if len(*keys) >= opt.Samples {
+		return
+	}
+	if b, ok := any(k).([]byte); ok {
+		k = any(append([]byte{}, b...)).(K)
+	}
+	*keys = append(*keys, k)
+}
+
+//先遍历旧的map的data,在新的map中查找每个键，统计删除，修改以及未变的键；
+//再遍历新的map的data,在旧的map中查找每个键，统计新增的键。两个map都不需要额外的内存，查找时也不会记录两个map的Metrics
+func diffMaps[K any, M mergeSource[K]](old, new M, opt DiffOptions) (DiffResult[K], error) {
+	var d DiffResult[K]
+	if !old.finished() || !new.finished() {
+		return d, ErrNotFinished
+	}
+	old.Range(func(k K, v []byte) bool {
+		other, exist := sourceValue[K](new, k)
+		switch {
+		case !exist:
+			d.Removed = d.Removed + 1
+			d.sample(&d.RemovedKeys, k, opt)
+		case !bytes.Equal(v, other):
+			d.Changed = d.Changed + 1
+			d.sample(&d.ChangedKeys, k, opt)
+		default:
+			d.Unchanged = d.Unchanged + 1
+		}
+		return true
+	})
+	new.Range(func(k K, v []byte) bool {
+		if _, exist := old.find(k); !exist {
+			d.Added = d.Added + 1
+			d.sample(&d.AddedKeys, k, opt)
+		}
+		return true
+	})
+	return d, nil
+}
+
+//比较两个已完成存储的默认类型的map,返回从old到new新增，删除以及修改的键
+//按data的顺序遍历并通过索引查找，适用于比较两个从快照加载(包括mmap)的map,两个map都不受影响
+func Diff(old, new *NoGcStaticMapAny, opt DiffOptions) (DiffResult[[]byte], error) {
+	return diffMaps[[]byte](old, new, opt)
+}
+
+//比较两个已完成存储的Huge类型的map 同Diff
+func DiffHuge(old, new *NoGcStaticMapHuge, opt DiffOptions) (DiffResult[[]byte], error) {
+	return diffMaps[[]byte](old, new, opt)
+}
+
+//比较两个已完成存储的int类型的map 同Diff
+func DiffInt(old, new *NoGcStaticMapInt, opt DiffOptions) (DiffResult[int], error) {
+	return diffMaps[int](old, new, opt)
+}
+
+//比较两个已完成存储的uint32类型的map 同Diff
+func DiffUint32(old, new *NoGcStaticMapUint32, opt DiffOptions) (DiffResult[uint32], error) {
+	return diffMaps[uint32](old, new, opt)
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	//旧的map中的键为[0,1000),新的map中的键为[100,1100),其中[100,200)的值被修改
+	old := NewDefaultWithOptions(Options{InMemory: true})
+	new := NewDefaultWithOptions(Options{InMemory: true})
+	oldInt := NewIntWithOptions(Options{InMemory: true})
+	newInt := NewIntWithOptions(Options{InMemory: true})
+	for k := 0; k < 1000; k++ {
+		old.SetString(strconv.Itoa(k), strconv.Itoa(k))
+		oldInt.SetString(k, strconv.Itoa(k))
+	}
+	for k := 100; k < 1100; k++ {
+		v := strconv.Itoa(k)
+		if k < 200 {
+			v = v + "x"
+		}
+		new.SetString(strconv.Itoa(k), v)
+		newInt.SetString(k, v)
+	}
+	if _, err := Diff(old, new, DiffOptions{}); !errors.Is(err, ErrNotFinished) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrNotFinished)
+	}
+	old.SetFinished()
+	oldInt.SetFinished()
+	new.SetFinished()
+	newInt.SetFinished()
+
+	//从快照以mmap的方式加载后比较
+	dir := t.TempDir()
+	if err := old.SaveToFile(filepath.Join(dir, "old")); err != nil {
+		t.Fatalf("cannot save snapshot: %s", err)
+	}
+	if err := new.SaveToFile(filepath.Join(dir, "new")); err != nil {
+		t.Fatalf("cannot save snapshot: %s", err)
+	}
+	oldMapped, err := LoadDefaultMmap(filepath.Join(dir, "old"))
+	if err != nil {
+		t.Fatalf("cannot load snapshot: %s", err)
+	}
+	defer oldMapped.Close()
+	newMapped, err := LoadDefaultMmap(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatalf("cannot load snapshot: %s", err)
+	}
+	defer newMapped.Close()
+
+	//比较时不会记录两个map的统计指标
+	metrics := NewMetrics("mapDiffMetricsForTest")
+	oldMapped.SetMetrics(metrics)
+	newMapped.SetMetrics(metrics)
+	d, err := Diff(oldMapped, newMapped, DiffOptions{Samples: 3})
+	if err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if d.Added != 100 || d.Removed != 100 || d.Changed != 100 || d.Unchanged != 800 || d.Equal() {
+		t.Fatalf("unexpected diff obtained; got %+v", d)
+	}
+	if s := metrics.Snapshot(); s.Hits != 0 || s.Misses != 0 {
+		t.Fatalf("unexpected metrics obtained; got %d %d want 0 0", s.Hits, s.Misses)
+	}
+	if len(d.AddedKeys) != 3 || string(d.AddedKeys[0]) != "1000" || string(d.RemovedKeys[0]) != "0" || string(d.ChangedKeys[2]) != "102" {
+		t.Fatalf("unexpected samples obtained; got %q %q %q", d.AddedKeys, d.RemovedKeys, d.ChangedKeys)
+	}
+
+	dInt, err := DiffInt(oldInt, newInt, DiffOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if dInt.Added != 100 || dInt.Removed != 100 || dInt.Changed != 100 || len(dInt.AddedKeys) != 0 {
+		t.Fatalf("unexpected diff obtained; got %+v", dInt)
+	}
+	if dInt, _ = DiffInt(oldInt, oldInt, DiffOptions{}); !dInt.Equal() || dInt.Unchanged != 1000 {
+		t.Fatalf("unexpected diff obtained; got %+v", dInt)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestDuplicatePolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy DuplicatePolicy
+		want   string
+	}{
+		{DuplicateKeepFirst, "first"},
+		{DuplicateKeepLast, "last"},
+	} {
+		m := NewDefaultWithOptions(Options{TempFileName: "mapAnyDuplicateForTest", Duplicate: c.policy})
+		mh := NewHugeWithOptions(Options{TempFileName: "mapHugeDuplicateForTest", Duplicate: c.policy})
+		mi := NewIntWithOptions(Options{TempFileName: "mapIntDuplicateForTest", Duplicate: c.policy})
+		for i := 0; i < 1000; i++ {
+			m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+			mh.SetString(strconv.Itoa(i), strconv.Itoa(i))
+			mi.SetString(i, strconv.Itoa(i))
+		}
+		for _, v := range []string{"first", "middle", "last"} {
+			m.SetString("dup", v)
+			mh.SetString("dup", v)
+			mi.SetString(-1, v)
+		}
+		m.SetFinished()
+		mh.SetFinished()
+		mi.SetFinished()
+		if m.Len() != 1001 || mh.Len() != 1001 || mi.Len() != 1001 {
+			t.Fatalf("unexpected len obtained; got %v %v %v want %v", m.Len(), mh.Len(), mi.Len(), 1001)
+		}
+		if val, _ := m.GetString("dup"); val != c.want {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, c.want)
+		}
+		if val, _ := mh.GetString("dup"); val != c.want {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, c.want)
+		}
+		if val, _ := mi.GetString(-1); val != c.want {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, c.want)
+		}
+	}
+}
+
+func TestDuplicateError(t *testing.T) {
+	m := NewHuge("mapHugeDuplicateErrorForTest")
+	defer m.SetFinished()
+	for i := 0; i < 1000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	//第2次加载相同的键时就能检测到
+	for i := 0; i < 1000; i++ {
+		if err := m.TrySet([]byte(strconv.Itoa(i)), nil); !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrDuplicateKey)
+		}
+	}
+	if m.Len() != 1000 {
+		t.Fatalf("unexpected len obtained; got %v want %v", m.Len(), 1000)
+	}
+}
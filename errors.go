@@ -0,0 +1,47 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"fmt"
+)
+
+//TrySet,TryGet,Finish等函数返回的错误，可以用errors.Is判断
+var (
+	ErrDuplicateKey  = errors.New("duplicate key")
+	ErrValueTooLarge = errors.New("k or v is too long")
+	ErrDataTooLarge  = errors.New("data is larger than 4GB, please use Options.Offset64")
+	ErrFinished      = errors.New("map is already finished")
+	ErrNotFinished   = errors.New("map is not finished yet")
+	ErrAborted       = errors.New("map building is aborted")
+	ErrCorrupted     = errors.New("data and index of map are inconsistent")
+)
+
+//与某个键相关的错误
+type KeyError struct {
+	Key interface{} //出错的键,默认类型及Huge类型中为[]byte,整型类型中为int或者uint32
+	Err error       //具体的错误
+}
+
+//创建与某个键相关的错误，[]byte类型的键会被复制，调用方之后可以继续复用该键
+func newKeyError(k interface{}, err error) *KeyError {
+	if b, ok := k.([]byte); ok {
+		k = append([]byte{}, b...)
+	}
+	return &KeyError{Key: k, Err: err}
+}
+
+func (e *KeyError) Error() string {
+	if b, ok := e.Key.([]byte); ok {
+		return fmt.Sprintf("%v, key: %q", e.Err, b)
+	}
+	return fmt.Sprintf("%v, key: %v", e.Err, e.Key)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
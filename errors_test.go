@@ -0,0 +1,63 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTrySet(t *testing.T) {
+	m := NewDefault("mapAnyTrySetForTest")
+	if err := m.TrySet([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	err := m.TrySet([]byte("a"), []byte("1"))
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrDuplicateKey)
+	}
+	var keyErr *KeyError
+	if !errors.As(err, &keyErr) || string(keyErr.Key.([]byte)) != "a" {
+		t.Fatalf("unexpected error obtained; got %v", err)
+	}
+	if err := m.TrySet([]byte("b"), make([]byte, 65536)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrValueTooLarge)
+	}
+	if _, _, err := m.TryGet([]byte("a")); !errors.Is(err, ErrNotFinished) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrNotFinished)
+	}
+	if err := m.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	//再次Finish时的错误不应提到Set
+	if err := m.Finish(); err != ErrFinished || err.Error() != "map is already finished" {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrFinished)
+	}
+	if err := m.TrySet([]byte("c"), nil); !errors.Is(err, ErrFinished) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrFinished)
+	}
+	if v, exist, err := m.TryGet([]byte("a")); err != nil || !exist || string(v) != "1" {
+		t.Fatalf("unexpected value obtained; got %q %v %v", v, exist, err)
+	}
+}
+
+func TestTrySetInt(t *testing.T) {
+	m := NewInt("mapIntTrySetForTest")
+	if err := m.TrySet(-1, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	err := m.TrySet(-1, []byte("1"))
+	if !errors.Is(err, ErrDuplicateKey) || !strings.Contains(err.Error(), "-1") {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrDuplicateKey)
+	}
+	if err := m.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("unexpected len obtained; got %v want %v", m.Len(), 1)
+	}
+}
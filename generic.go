@@ -0,0 +1,265 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cespare/xxhash"
+	"sync"
+	"unsafe"
+)
+
+//键或者值的编码方式
+//Encode把v编码后追加到dst并返回;Decode从b中解码,b是map内部数据的引用,Decode返回的结果不能引用b
+type Codec[T any] interface {
+	Encode(dst []byte, v T) []byte
+	Decode(b []byte) (T, error)
+}
+
+//所有的整型
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+//泛型的静态map,键和值通过Codec编码后存储在NoGcStaticMapHuge中，
+//新增一种键或者值的类型时只需实现对应的Codec,Get直接返回V类型的值
+type NoGcStaticMap[K, V any] struct {
+	m  *NoGcStaticMapHuge
+	kc Codec[K]
+	vc Codec[V]
+}
+
+//编码键时使用的缓存池
+var keyBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 64)
+		return &b
+	},
+}
+
+//初始化 kc,vc分别为键和值的编码方式
+func NewGeneric[K, V any](kc Codec[K], vc Codec[V], opt Options) *NoGcStaticMap[K, V] {
+	return &NoGcStaticMap[K, V]{m: NewHugeWithOptions(opt), kc: kc, vc: vc}
+}
+
+//从NoGcStaticMap.SaveToFile保存的快照文件中加载，加载后即可直接查询
+//kc,vc的类型必须与保存时使用的编码方式一致，否则返回错误
+func LoadGeneric[K, V any](fileName string, kc Codec[K], vc Codec[V]) (*NoGcStaticMap[K, V], error) {
+	m, err := loadHuge(fileName, kindGeneric, codecTag(kc, vc), false)
+	if err != nil {
+		return nil, err
+	}
+	return &NoGcStaticMap[K, V]{m: m, kc: kc, vc: vc}, nil
+}
+
+//以mmap的方式只读打开NoGcStaticMap.SaveToFile保存的快照文件，不再使用时应调用Close释放映射
+func LoadGenericMmap[K, V any](fileName string, kc Codec[K], vc Codec[V]) (*NoGcStaticMap[K, V], error) {
+	m, err := loadHuge(fileName, kindGeneric, codecTag(kc, vc), true)
+	if err != nil {
+		return nil, err
+	}
+	return &NoGcStaticMap[K, V]{m: m, kc: kc, vc: vc}, nil
+}
+
+//根据键和值的编码方式的类型名计算快照中记录的tag,加载时用于检查编码方式是否一致
+func codecTag[K, V any](kc Codec[K], vc Codec[V]) uint64 {
+	return xxhash.Sum64String(fmt.Sprintf("%T,%T", kc, vc))
+}
+
+//增加数据
+func (n *NoGcStaticMap[K, V]) Set(k K, v V) {
+	bp := keyBufPool.Get().(*[]byte)
+	kb := n.kc.Encode((*bp)[:0], k)
+	n.m.Set(kb, n.vc.Encode(nil, v))
+	*bp = kb
+	keyBufPool.Put(bp)
+}
+
+//增加数据,出错时返回*KeyError而不是panic,错误中的键为编码后的[]byte
+func (n *NoGcStaticMap[K, V]) TrySet(k K, v V) error {
+	return n.m.TrySet(n.kc.Encode(nil, k), n.vc.Encode(nil, v))
+}
+
+//取出数据 值无法解码时返回不存在，需要区分时使用TryGet
+func (n *NoGcStaticMap[K, V]) Get(k K) (v V, exist bool) {
+	if !n.m.setFinished {
+		panic("cant't Get before SetFinished")
+	}
+	v, exist, err := n.TryGet(k)
+	if err != nil {
+		return v, false
+	}
+	return v, exist
+}
+
+//取出数据,在SetFinished之前调用时返回ErrNotFinished,值无法解码时返回*KeyError而不是panic,错误中的键为编码后的[]byte
+func (n *NoGcStaticMap[K, V]) TryGet(k K) (v V, exist bool, err error) {
+	if !n.m.setFinished {
+		return v, false, ErrNotFinished
+	}
+	bp := keyBufPool.Get().(*[]byte)
+	kb := n.kc.Encode((*bp)[:0], k)
+	vb, exist := n.m.GetUnsafe(kb)
+	if exist {
+		if v, err = n.vc.Decode(vb); err != nil {
+			err = newKeyError(kb, err)
+		}
+	}
+	*bp = kb
+	keyBufPool.Put(bp)
+	if err != nil {
+		return v, false, err
+	}
+	return v, exist, nil
+}
+
+//取出编码后的值并追加到dst之后返回，复用dst可以避免每次分配内存，键不存在时原样返回dst
+func (n *NoGcStaticMap[K, V]) AppendValue(dst []byte, k K) ([]byte, bool) {
+	bp := keyBufPool.Get().(*[]byte)
+	kb := n.kc.Encode((*bp)[:0], k)
+	dst, exist := n.m.AppendValue(dst, kb)
+	*bp = kb
+	keyBufPool.Put(bp)
+	return dst, exist
+}
+
+//遍历所有的键值对,fn返回false时停止遍历 跳过无法解码的键值对，需要知道解码错误时使用TryRange
+func (n *NoGcStaticMap[K, V]) Range(fn func(k K, v V) bool) {
+	n.rangeDecoded(fn, true)
+}
+
+//遍历所有的键值对,fn返回false时停止遍历 在SetFinished之前调用时返回ErrNotFinished,
+//遇到无法解码的键值对时停止遍历并返回*KeyError,错误中的键为编码后的[]byte
+func (n *NoGcStaticMap[K, V]) TryRange(fn func(k K, v V) bool) error {
+	if !n.m.setFinished {
+		return ErrNotFinished
+	}
+	return n.rangeDecoded(fn, false)
+}
+
+//解码并遍历所有的键值对 skip为true时跳过无法解码的键值对，否则停止遍历并返回错误
+func (n *NoGcStaticMap[K, V]) rangeDecoded(fn func(k K, v V) bool, skip bool) (err error) {
+	n.m.Range(func(kb, vb []byte) bool {
+		k, decodeErr := n.kc.Decode(kb)
+		if decodeErr == nil {
+			var v V
+			if v, decodeErr = n.vc.Decode(vb); decodeErr == nil {
+				return fn(k, v)
+			}
+		}
+		if skip {
+			return true
+		}
+		err = newKeyError(kb, decodeErr)
+		return false
+	})
+	return err
+}
+
+//完成存储
+func (n *NoGcStaticMap[K, V]) SetFinished() {
+	n.m.SetFinished()
+}
+
+//完成存储,出错时返回错误而不是panic
+func (n *NoGcStaticMap[K, V]) Finish() error {
+	return n.m.Finish()
+}
+
+//返回键值对个数
+func (n *NoGcStaticMap[K, V]) Len() int {
+	return n.m.Len()
+}
+
+//把已完成存储的数据及索引保存到快照文件，之后可以用LoadGeneric直接加载
+//快照中记录了键和值的编码方式，不能用LoadHuge等加载，也不能用其它编码方式的LoadGeneric加载
+func (n *NoGcStaticMap[K, V]) SaveToFile(fileName string) error {
+	return n.m.saveToFile(fileName, kindGeneric, codecTag(n.kc, n.vc))
+}
+
+//放弃构建并删除临时文件，之后不能再Set以及SetFinished
+func (n *NoGcStaticMap[K, V]) Abort() error {
+	return n.m.Abort()
+}
+
+//释放map占用的数据，对于以mmap方式打开的map会解除文件映射，对于尚未SetFinished的map相当于Abort,之后不能再查询
+func (n *NoGcStaticMap[K, V]) Close() error {
+	return n.m.Close()
+}
+
+//整型的编码方式,固定占用8个字节,大端序
+type IntegerCodec[T Integer] struct{}
+
+func (IntegerCodec[T]) Encode(dst []byte, v T) []byte {
+	return binary.BigEndian.AppendUint64(dst, uint64(v))
+}
+
+func (IntegerCodec[T]) Decode(b []byte) (T, error) {
+	if len(b) != 8 {
+		return 0, errors.New("invalid integer length")
+	}
+	return T(binary.BigEndian.Uint64(b)), nil
+}
+
+//字符串的编码方式
+type StringCodec struct{}
+
+func (StringCodec) Encode(dst []byte, v string) []byte {
+	return append(dst, v...)
+}
+
+func (StringCodec) Decode(b []byte) (string, error) {
+	return string(b), nil
+}
+
+//[]byte的编码方式
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(dst []byte, v []byte) []byte {
+	return append(dst, v...)
+}
+
+func (BytesCodec) Decode(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), b...), nil
+}
+
+//定长类型的编码方式，直接复制内存中的内容，适用于[16]byte等数组以及不含指针的结构体
+//警告:
+//1)T中不能包含指针,string,切片,map等引用类型;
+//2)编码结果与平台的字节序相关，快照文件不能在字节序不同的平台之间使用
+type FixedCodec[T any] struct{}
+
+func (FixedCodec[T]) Encode(dst []byte, v T) []byte {
+	return append(dst, unsafe.Slice((*byte)(unsafe.Pointer(&v)), unsafe.Sizeof(v))...)
+}
+
+func (FixedCodec[T]) Decode(b []byte) (v T, err error) {
+	if uintptr(len(b)) != unsafe.Sizeof(v) {
+		return v, errors.New("invalid fixed size value length")
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&v)), unsafe.Sizeof(v)), b)
+	return v, nil
+}
+
+//JSON的编码方式,适用于结构体等复杂类型
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(dst []byte, v T) []byte {
+	b, err := json.Marshal(v)
+	haserrPanic(err)
+	return append(dst, b...)
+}
+
+func (JSONCodec[T]) Decode(b []byte) (v T, err error) {
+	err = json.Unmarshal(b, &v)
+	return v, err
+}
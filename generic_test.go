@@ -0,0 +1,149 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"crypto/md5"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestGenericInteger(t *testing.T) {
+	m := NewGeneric[int64, string](IntegerCodec[int64]{}, StringCodec{}, Options{TempFileName: "mapGenericIntForTest"})
+	for i := -5000; i < 5000; i++ {
+		m.Set(int64(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	for i := -5000; i < 5000; i++ {
+		val, exist := m.Get(int64(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+	if _, exist := m.Get(5000); exist {
+		t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+	}
+	//快照
+	fileName := filepath.Join(t.TempDir(), "generic.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGeneric[int64, string](fileName, IntegerCodec[int64]{}, StringCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := loaded.Get(-1); val != "-1" {
+		t.Fatalf("unexpected value obtained; got %q want %q", val, "-1")
+	}
+}
+
+func TestGenericFixedKey(t *testing.T) {
+	m := NewGeneric[[16]byte, NoGcStructExample](FixedCodec[[16]byte]{}, JSONCodec[NoGcStructExample]{}, Options{TempFileName: "mapGenericFixedForTest"})
+	for i := 0; i < 1000; i++ {
+		m.Set(md5.Sum([]byte(strconv.Itoa(i))), NoGcStructExample{Col1: i, Col2: strconv.Itoa(i)})
+	}
+	m.SetFinished()
+	for i := 0; i < 1000; i++ {
+		val, exist := m.Get(md5.Sum([]byte(strconv.Itoa(i))))
+		if !exist || val.Col1 != i || val.Col2 != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %v want %v", val, i)
+		}
+	}
+	if m.Len() != 1000 {
+		t.Fatalf("unexpected len obtained; got %v want %v", m.Len(), 1000)
+	}
+}
+
+//只能解码偶数的编码方式，用于测试解码出错
+type evenCodec struct {
+	IntegerCodec[int64]
+}
+
+func (c evenCodec) Decode(b []byte) (int64, error) {
+	v, err := c.IntegerCodec.Decode(b)
+	if err == nil && v%2 != 0 {
+		return 0, errors.New("odd value")
+	}
+	return v, err
+}
+
+func TestGenericDecodeError(t *testing.T) {
+	m := NewGeneric[string, int64](StringCodec{}, evenCodec{}, Options{InMemory: true})
+	if _, _, err := m.TryGet("1"); !errors.Is(err, ErrNotFinished) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrNotFinished)
+	}
+	for i := 0; i < 10; i++ {
+		m.Set(strconv.Itoa(i), int64(i))
+	}
+	m.SetFinished()
+	if v, exist, err := m.TryGet("2"); err != nil || !exist || v != 2 {
+		t.Fatalf("unexpected value obtained; got %v %v %v want 2 true nil", v, exist, err)
+	}
+	var ke *KeyError
+	if _, exist, err := m.TryGet("3"); !errors.As(err, &ke) || exist || string(ke.Key.([]byte)) != "3" {
+		t.Fatalf("unexpected error obtained; got %v want odd value for key 3", err)
+	}
+	if _, exist := m.Get("3"); exist {
+		t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+	}
+	count := 0
+	m.Range(func(k string, v int64) bool {
+		count = count + 1
+		return true
+	})
+	if count != 5 {
+		t.Fatalf("unexpected count obtained; got %d want %d", count, 5)
+	}
+	if err := m.TryRange(func(k string, v int64) bool { return true }); err == nil {
+		t.Fatalf("expected decode error from TryRange")
+	}
+}
+
+//快照中记录了map的类型以及编码方式，不一致时加载失败
+func TestGenericSnapshotMismatch(t *testing.T) {
+	dir := t.TempDir()
+	huge := NewHugeWithOptions(Options{InMemory: true})
+	huge.SetString("a", "xyz")
+	huge.SetFinished()
+	hugeFile := filepath.Join(dir, "huge.snapshot")
+	if err := huge.SaveToFile(hugeFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGeneric[string, int64](hugeFile, StringCodec{}, IntegerCodec[int64]{}); err == nil {
+		t.Fatalf("expected kind mismatch error")
+	}
+
+	m := NewGeneric[string, int64](StringCodec{}, IntegerCodec[int64]{}, Options{InMemory: true})
+	m.Set("a", 1)
+	m.SetFinished()
+	fileName := filepath.Join(dir, "generic.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHuge(fileName); err == nil {
+		t.Fatalf("expected kind mismatch error")
+	}
+	if _, err := LoadGeneric[string, string](fileName, StringCodec{}, StringCodec{}); err == nil {
+		t.Fatalf("expected codec mismatch error")
+	}
+	if _, err := LoadGenericMmap[string, int32](fileName, StringCodec{}, IntegerCodec[int32]{}); err == nil {
+		t.Fatalf("expected codec mismatch error")
+	}
+	loaded, err := LoadGenericMmap[string, int64](fileName, StringCodec{}, IntegerCodec[int64]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if v, _ := loaded.Get("a"); v != 1 {
+		t.Fatalf("unexpected value obtained; got %v want %v", v, 1)
+	}
+	info, err := ReadSnapshotInfo(fileName)
+	if err != nil || info.Kind != "generic" {
+		t.Fatalf("unexpected kind obtained; got %q want %q", info.Kind, "generic")
+	}
+}
@@ -6,101 +6,176 @@
 package noGcStaticMap
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/binary"
 	"github.com/cespare/xxhash"
-	"io/ioutil"
-	"os"
+	"math"
+	"time"
+	"unsafe"
 )
 
 //其它类型，值最长为65535，此类型无此限制
 type NoGcStaticMapHuge struct {
-	setFinished         bool //是否完成存储
-	dataBeginPos        int  //游标，记录位置
-	len                 int  //记录键值对个数
-	bw                  *bufio.Writer
-	tempFile            *os.File               //硬盘上的临时文件
-	tempFileName        string                 //临时文件名
-	data                []byte                 //存储键值的内容
-	index               [512]map[uint64]uint32 //值为切片data []byte中的某个位置,此索引存储无hash冲突的key的hash值以及有hash冲突但是是第1次出现的key的hash值
-	mapForHashCollision map[string]uint32      //值为切片data []byte中的某个位置,string为存放有hash冲突的第2次或2次以上出现的key,这个map一般来说是非常小的
+	setFinished  bool            //是否完成存储
+	offset64     bool            //索引中的位置是否使用8个字节,即data是否可以超过4G
+	dataBeginPos int             //游标，记录位置
+	len          int             //记录键值对个数
+	dead         int             //被DuplicateKeepLast覆盖的键值对个数,这些键值对仍在data中，但索引不再指向它们
+	duplicate    DuplicatePolicy //遇到重复的键的处理方式
+	storage      *buildStorage   //构建期间存放键值对的地方,SetFinished后释放
+	data         []byte          //存储键值的内容
+	mapped       []byte          //以mmap方式打开快照时映射的文件内容
+	metrics      *Metrics        //查询的统计指标,为nil时不统计
+	checksum     uint64          //从快照加载时快照中记录的data的校验和,用于Verify
+	hasChecksum  bool            //快照中是否记录了data的校验和
+	hashIndex                    //键的索引
 }
 
 //初始化 对键值的长度不做限制，除非是存储值的长度超长的情况，否则不建议使用此类型，因为会占用更多的空间
 func NewHuge(tempFileName ...string) *NoGcStaticMapHuge {
+	return NewHugeWithOptions(optionsFromTempFileName(tempFileName))
+}
+
+//按初始化参数初始化
+func NewHugeWithOptions(opt Options) *NoGcStaticMapHuge {
+	n, err := TryNewHugeWithOptions(opt)
+	haserrPanic(err)
+	return n
+}
+
+//按初始化参数初始化 创建临时文件失败时返回错误而不是panic,适用于只读的容器等可能无法写硬盘的场景
+func TryNewHugeWithOptions(opt Options) (*NoGcStaticMapHuge, error) {
 	var n NoGcStaticMapHuge
-	n.mapForHashCollision = make(map[string]uint32)
-	for i := range n.index {
-		n.index[i] = make(map[uint64]uint32)
+	n.hashIndex.initBuild(opt.Index)
+	n.offset64 = opt.Offset64
+	n.duplicate = opt.Duplicate
+	storage, err := newBuildStorage(opt)
+	if err != nil {
+		return nil, err
 	}
-	n.tempFileName, n.tempFile, n.bw = createTempFile(tempFileName...)
-	return &n
+	n.storage = storage
+	return &n, nil
 }
 
 //取出数据
 func (n *NoGcStaticMapHuge) Get(k []byte) (v []byte, exist bool) {
-	if !n.setFinished {
-		panic("cant't Get before SetFinished")
-	}
-	h := xxhash.Sum64(k)
-	idx := h % 512
-	dataBeginPos, exist := n.index[idx][h]
-	if exist {
-		v, exist = n.read(k, int(dataBeginPos))
-		if exist {
-			return
-		}
+	dataBeginPos, exist := n.GetDataBeginPosOfKVPair64(k)
+	if !exist {
+		return v, false
 	}
-	//上面没找到，再从可能存在hash冲突的小表查找
-	dataBeginPos, exist = n.mapForHashCollision[string(k)]
-	if exist {
-		return n.read(k, int(dataBeginPos))
+	return n.read(int(dataBeginPos)), true
+}
+
+//取出数据,在SetFinished之前调用时返回ErrNotFinished而不是panic
+func (n *NoGcStaticMapHuge) TryGet(k []byte) (v []byte, exist bool, err error) {
+	if !n.setFinished {
+		return nil, false, ErrNotFinished
 	}
-	return v, false
+	v, exist = n.Get(k)
+	return v, exist, nil
 }
 
 //取出数据 警告:返回的数据是hash表中值的引用，而非值的复制品，要注意不要在外部改变该返回值
 func (n *NoGcStaticMapHuge) GetUnsafe(k []byte) (v []byte, exist bool) {
-	dataBeginPos, exist := n.GetDataBeginPosOfKVPair(k)
+	dataBeginPos, exist := n.GetDataBeginPosOfKVPair64(k)
 	if !exist {
 		return nil, false
 	}
 	return n.GetValFromDataBeginPosOfKVPairUnSafe(int(dataBeginPos)), true
 }
 
+//取出数据并追加到dst之后返回，复用dst可以避免每次分配内存，返回的数据不会引用map内部的数据，键不存在时原样返回dst
+func (n *NoGcStaticMapHuge) AppendValue(dst []byte, k []byte) ([]byte, bool) {
+	v, exist := n.GetUnsafe(k)
+	if !exist {
+		return dst, false
+	}
+	return append(dst, v...), true
+}
+
 //取出数据,以string的方式
 func (n *NoGcStaticMapHuge) GetString(k string) (v string, exist bool) {
-	vbyte, exist := n.Get([]byte(k))
+	val, exist := n.getStringUnsafe(k)
 	if exist {
-		return string(vbyte), true
+		return string(val), true
 	}
 	return v, false
 }
 
+//取出数据,以string的方式 警告:返回的string直接引用map内部的数据，不能在Close之后继续使用
+func (n *NoGcStaticMapHuge) GetStringUnsafe(k string) (v string, exist bool) {
+	val, exist := n.getStringUnsafe(k)
+	if !exist || len(val) == 0 {
+		return v, exist
+	}
+	return unsafe.String(&val[0], len(val)), true
+}
+
+//以string类型的键查找，直接计算string的hash值并比较，无需转换为[]byte 返回的数据是data中的引用
+func (n *NoGcStaticMapHuge) getStringUnsafe(k string) (v []byte, exist bool) {
+	if !n.setFinished {
+		panic("cant't Get before SetFinished")
+	}
+	match := func(dataBeginPos int) bool {
+		return string(n.keyAt(dataBeginPos)) == k
+	}
+	var start time.Time
+	if n.metrics != nil {
+		start = n.metrics.start()
+	}
+	dataBeginPos, exist := n.hashIndex.search(xxhash.Sum64String(k), match)
+	if n.metrics != nil {
+		n.metrics.observe(start, exist)
+	}
+	if !exist {
+		return nil, false
+	}
+	return n.GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos), true
+}
+
 //取出键值对在数据中存储的开始位置
 func (n *NoGcStaticMapHuge) GetDataBeginPosOfKVPair(k []byte) (uint32, bool) {
 	if !n.setFinished {
 		panic("cant't Get before SetFinished")
 	}
-	h := xxhash.Sum64(k)
-	idx := h % 512
-	dataBeginPos, exist := n.index[idx][h]
-	if exist {
-		_, exist = n.read(k, int(dataBeginPos))
-		if exist {
-			return dataBeginPos, true
-		}
+	dataBeginPos, exist := n.lookup(k)
+	if uint64(dataBeginPos) > math.MaxUint32 {
+		panic("dataBeginPos is larger than 4GB, please use GetDataBeginPosOfKVPair64")
 	}
-	//上面没找到，再从可能存在hash冲突的小表查找
-	dataBeginPos, exist = n.mapForHashCollision[string(k)]
-	if exist {
-		_, exist = n.read(k, int(dataBeginPos))
-		if exist {
-			return dataBeginPos, true
-		}
+	return uint32(dataBeginPos), exist
+}
+
+//取出键值对在数据中存储的开始位置,data超过4G(Offset64)时使用
+func (n *NoGcStaticMapHuge) GetDataBeginPosOfKVPair64(k []byte) (uint64, bool) {
+	if !n.setFinished {
+		panic("cant't Get before SetFinished")
 	}
-	return 0, false
+	dataBeginPos, exist := n.lookup(k)
+	return uint64(dataBeginPos), exist
+}
+
+//查找键在data中的位置,设置了Metrics时记录是否命中以及延迟
+func (n *NoGcStaticMapHuge) lookup(k []byte) (int, bool) {
+	if n.metrics == nil {
+		return n.find(k)
+	}
+	start := n.metrics.start()
+	dataBeginPos, exist := n.find(k)
+	n.metrics.observe(start, exist)
+	return dataBeginPos, exist
+}
+
+//从索引中查找键在data中的位置
+func (n *NoGcStaticMapHuge) find(k []byte) (int, bool) {
+	return n.findHash(k, xxhash.Sum64(k))
+}
+
+//从索引中查找键在data中的位置,h为k的hash值
+func (n *NoGcStaticMapHuge) findHash(k []byte, h uint64) (int, bool) {
+	match := func(dataBeginPos int) bool {
+		return bytes.Equal(k, n.keyAt(dataBeginPos))
+	}
+	return n.hashIndex.search(h, match)
 }
 
 //从内存中的某个位置取出键值对中值的数据
@@ -119,26 +194,86 @@ func (n *NoGcStaticMapHuge) GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos in
 
 //增加数据
 func (n *NoGcStaticMapHuge) Set(k, v []byte) {
-	n.len = n.len + 1
+	if err := n.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加数据,出错时返回*KeyError而不是panic
+func (n *NoGcStaticMapHuge) TrySet(k, v []byte) error {
+	return n.trySet(k, xxhash.Sum64(k), v)
+}
+
+//增加数据,h为k的hash值,由调用方计算
+func (n *NoGcStaticMapHuge) trySet(k []byte, h uint64, v []byte) error {
 	//键值设置完之后，不允许再添加
 	if n.setFinished {
-		panic("can't Set after SetFinished")
+		return newKeyError(k, ErrFinished)
+	}
+	if n.storage == nil {
+		return newKeyError(k, ErrAborted)
+	}
+	//K,V的长度各自用4个字节表示
+	if uint64(len(k)) > math.MaxUint32 || uint64(len(v)) > math.MaxUint32 {
+		return newKeyError(k, ErrValueTooLarge)
+	}
+	//索引中的位置默认只占4个字节，data超过4G时无法表示
+	if !n.offset64 && uint64(n.dataBeginPos) >= math.MaxUint32 {
+		return newKeyError(k, ErrDataTooLarge)
 	}
-	h := xxhash.Sum64(k)
 	idx := h % 512
-	//处理hash碰撞问题
-	_, exist := n.index[idx][h]
-	if exist {
-		//尽可能的避免重复加载,如果在mapNoHashCollision加载过，确实也是无法检测的，但是如果加载了3次一定会被检测到
-		if _, exist := n.mapForHashCollision[string(k)]; exist {
-			panic("can't add the key '" + string(k) + "' for twice")
+	//处理hash碰撞问题 hash值相同时比较临时文件中已写入的键，确认是否为重复的键
+	oldDataBeginPos, hashExist := n.index[idx][h]
+	duplicate, collision := false, false
+	if hashExist {
+		var err error
+		duplicate, err = n.sameKeyInTempFile(k, oldDataBeginPos)
+		if err != nil {
+			return newKeyError(k, err)
+		}
+		if !duplicate {
+			collision = true
+			_, duplicate = n.mapForHashCollision[string(k)]
+		}
+	}
+	if duplicate {
+		if skip, err := n.duplicate.handle(k); skip {
+			return err
 		}
-		n.mapForHashCollision[string(k)] = uint32(n.dataBeginPos)
-	} else {
-		n.index[idx][h] = uint32(n.dataBeginPos)
 	}
 	//存储数据到临时文件，并且移动游标
-	n.write(k, v)
+	dataBeginPos := uint64(n.dataBeginPos)
+	if err := n.write(k, v); err != nil {
+		return newKeyError(k, err)
+	}
+	if collision {
+		n.mapForHashCollision[string(k)] = dataBeginPos
+	} else {
+		n.index[idx][h] = dataBeginPos
+	}
+	if duplicate {
+		n.dead = n.dead + 1
+	} else {
+		n.len = n.len + 1
+	}
+	return nil
+}
+
+//比较构建期间的存储中某个位置上的键是否与k相同
+func (n *NoGcStaticMapHuge) sameKeyInTempFile(k []byte, dataBeginPos uint64) (bool, error) {
+	var kvLenBuf [8]byte
+	if _, err := n.storage.ReadAt(kvLenBuf[:], int64(dataBeginPos)); err != nil {
+		return false, err
+	}
+	keyLen := int(binary.LittleEndian.Uint32(kvLenBuf[0:4]))
+	if keyLen != len(k) {
+		return false, nil
+	}
+	key := make([]byte, keyLen)
+	if _, err := n.storage.ReadAt(key, int64(dataBeginPos)+8); err != nil {
+		return false, err
+	}
+	return bytes.Equal(k, key), nil
 }
 
 //增加数据,以string的方式
@@ -146,70 +281,225 @@ func (n *NoGcStaticMapHuge) SetString(k, v string) {
 	n.Set([]byte(k), []byte(v))
 }
 
-//从内存中读取相应数据 注意 K,V长度各自占4个字节
-func (n *NoGcStaticMapHuge) read(k []byte, dataBeginPos int) (v []byte, exist bool) {
-	//读取键值的长度
-	keyLen := binary.LittleEndian.Uint32(n.data[dataBeginPos : dataBeginPos+4])
-	dataBeginPos = dataBeginPos + 4
-	valLen := binary.LittleEndian.Uint32(n.data[dataBeginPos : dataBeginPos+4])
-	dataBeginPos = dataBeginPos + 4
-	//读取键的内容，并判断键是否相同
-	if !bytes.Equal(k, n.data[dataBeginPos:dataBeginPos+int(keyLen)]) {
-		return v, false
-	}
+//从内存中读取相应数据
+func (n *NoGcStaticMapHuge) read(dataBeginPos int) (v []byte) {
+	val := n.GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos)
 	//读取值并返回
-	if valLen == 0 {
-		return nil, true
+	if len(val) == 0 {
+		return nil
 	}
-	dataBeginPos = dataBeginPos + int(keyLen)
-	v = make([]byte, 0, int(valLen))
-	v = append(v, n.data[dataBeginPos:dataBeginPos+int(valLen)]...)
-	return v, true
+	v = make([]byte, 0, len(val))
+	v = append(v, val...)
+	return v
 }
 
 //往文件中写入数据 注意 K,V长度各自占4个字节
-func (n *NoGcStaticMapHuge) write(k, v []byte) {
+func (n *NoGcStaticMapHuge) write(k, v []byte) error {
 	dataLen := 8 + len(k) + len(v) //K,V各自占4个字节
-	kbuf := uint32ToByte(uint32(len(k)))
-	vbuf := uint32ToByte(uint32(len(v)))
-	//写入K的长度
-	_, err := n.bw.Write(kbuf[:])
-	haserrPanic(err)
-	//写入v的长度
-	_, err = n.bw.Write(vbuf[:])
-	haserrPanic(err)
+	var kvLenBuf [8]byte
+	binary.LittleEndian.PutUint32(kvLenBuf[0:4], uint32(len(k)))
+	binary.LittleEndian.PutUint32(kvLenBuf[4:8], uint32(len(v)))
+	//写入K,V的长度
+	if _, err := n.storage.Write(kvLenBuf[:]); err != nil {
+		return err
+	}
 	//写入k
-	for i := range k {
-		err = n.bw.WriteByte(k[i])
-		haserrPanic(err)
+	if _, err := n.storage.Write(k); err != nil {
+		return err
 	}
 	//写入V
-	for i := range v {
-		err = n.bw.WriteByte(v[i])
-		haserrPanic(err)
+	if _, err := n.storage.Write(v); err != nil {
+		return err
 	}
 	//写完了，移动游标
 	n.dataBeginPos = n.dataBeginPos + dataLen
+	return nil
 }
 
 //完成存储把存储到硬盘上的文件复制到内存
 func (n *NoGcStaticMapHuge) SetFinished() {
-	n.setFinished = true
-	err := n.bw.Flush()
-	haserrPanic(err)
-	if n.tempFile != nil {
-		err = n.tempFile.Close()
-		haserrPanic(err)
+	haserrPanic(n.Finish())
+}
+
+//完成存储,出错时返回错误而不是panic
+func (n *NoGcStaticMapHuge) Finish() error {
+	r, err := n.finishBuild()
+	if err != nil {
+		return err
 	}
-	b, err := ioutil.ReadFile(n.tempFileName)
-	haserrPanic(err)
-	n.data = make([]byte, 0, len(b))
-	n.data = append(n.data, b...)
-	err = os.Remove(n.tempFileName)
-	haserrPanic(err)
+	n.hashIndex.build(r.keys, r.poses, n.offset64)
+	return nil
+}
+
+//结束构建，把构建期间存储的键值对读入data,返回data以及所有键的hash值及其位置
+func (n *NoGcStaticMapHuge) finishBuild() (buildResult, error) {
+	if n.setFinished {
+		return buildResult{}, ErrFinished
+	}
+	if n.storage == nil {
+		return buildResult{}, ErrAborted
+	}
+	b, err := n.storage.finish()
+	if err != nil {
+		//storage.finish出错时已经删除了临时文件，这里释放构建期间的map,之后的Set返回ErrAborted
+		n.Abort()
+		return buildResult{}, err
+	}
+	n.setFinished = true
+	n.data = b
+	n.storage = nil
+	//收集所有键的hash值及其位置，之后构建期间使用的map就不再需要了
+	hashes, poses := n.hashIndex.collect(n.len)
+	return buildResult{data: n.data, keys: hashes, poses: poses, len: n.len, dead: n.dead}, nil
 }
 
 //返回键值对个数
 func (n *NoGcStaticMapHuge) Len() int {
 	return n.len
 }
+
+//是否已完成存储
+func (n *NoGcStaticMapHuge) finished() bool {
+	return n.setFinished
+}
+
+//把已完成存储的数据及索引保存到快照文件，之后可以用LoadHuge直接加载，无需再次Set
+func (n *NoGcStaticMapHuge) SaveToFile(fileName string) error {
+	return n.saveToFile(fileName, kindHuge, 0)
+}
+
+//保存快照，kind及tag记录在文件头中，泛型的map使用自己的kind以及由编码方式得到的tag
+func (n *NoGcStaticMapHuge) saveToFile(fileName string, kind uint32, tag uint64) error {
+	if !n.setFinished {
+		return errNotFinishedForSave
+	}
+	h := snapshotHeader{kind: kind, tag: tag, index: n.indexType, offset64: n.offset64, len: n.len, dead: n.dead}
+	return saveSnapshot(fileName, h, n.data, n.hashIndex.writeTo)
+}
+
+//从SaveToFile保存的快照文件中加载，加载后即可直接查询
+func LoadHuge(fileName string) (*NoGcStaticMapHuge, error) {
+	return loadHuge(fileName, kindHuge, 0, false)
+}
+
+//以mmap的方式只读打开SaveToFile保存的快照文件，data及索引直接引用映射的文件内容而不复制到堆上(大端序平台上索引仍需复制),
+//多个进程打开同一文件时可共享操作系统的页缓存。不再使用时应调用Close释放映射
+func LoadHugeMmap(fileName string) (*NoGcStaticMapHuge, error) {
+	return loadHuge(fileName, kindHuge, 0, true)
+}
+
+//加载快照，文件头中的kind及tag必须与参数一致
+func loadHuge(fileName string, kind uint32, tag uint64, useMmap bool) (*NoGcStaticMapHuge, error) {
+	if !useMmap {
+		h, data, index, err := loadSnapshot(fileName, kind)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkSnapshotTag(h, tag); err != nil {
+			return nil, err
+		}
+		return newHugeFromSnapshot(h, data, index, false)
+	}
+	h, data, index, mapped, err := mmapSnapshot(fileName, kind)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSnapshotTag(h, tag); err != nil {
+		munmapFile(mapped)
+		return nil, err
+	}
+	n, err := newHugeFromSnapshot(h, data, index, true)
+	if err != nil {
+		munmapFile(mapped)
+		return nil, err
+	}
+	n.mapped = mapped
+	return n, nil
+}
+
+//根据快照内容初始化
+func newHugeFromSnapshot(h snapshotHeader, data, index []byte, mapped bool) (*NoGcStaticMapHuge, error) {
+	var n NoGcStaticMapHuge
+	n.data = data
+	n.len = h.len
+	n.dead = h.dead
+	n.checksum = h.checksum
+	n.hasChecksum = h.hasChecksum
+	n.dataBeginPos = len(data)
+	n.setFinished = true
+	n.indexType = h.index
+	n.offset64 = h.offset64
+	if err := n.hashIndex.read(index, n.offset64, mapped); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+//读取某个位置上的键值对，返回键，值以及下一个键值对的位置 键和值都是data中的引用
+func (n *NoGcStaticMapHuge) recordAt(dataBeginPos int) (k, v []byte, next int) {
+	keyLen := int(binary.LittleEndian.Uint32(n.data[dataBeginPos : dataBeginPos+4]))
+	valLen := int(binary.LittleEndian.Uint32(n.data[dataBeginPos+4 : dataBeginPos+8]))
+	k = n.data[dataBeginPos+8 : dataBeginPos+8+keyLen]
+	v = n.data[dataBeginPos+8+keyLen : dataBeginPos+8+keyLen+valLen]
+	return k, v, dataBeginPos + 8 + keyLen + valLen
+}
+
+//读取某个位置上键值对中键的内容
+func (n *NoGcStaticMapHuge) keyAt(dataBeginPos int) []byte {
+	keyLen := int(binary.LittleEndian.Uint32(n.data[dataBeginPos : dataBeginPos+4]))
+	return n.data[dataBeginPos+8 : dataBeginPos+8+keyLen]
+}
+
+//放弃构建并删除临时文件，之后不能再Set以及SetFinished,构建失败或者不再需要时调用，可以用defer保证进程panic时也能删除
+func (n *NoGcStaticMapHuge) Abort() error {
+	if n.setFinished {
+		return ErrFinished
+	}
+	if n.storage == nil {
+		return nil
+	}
+	storage := n.storage
+	n.storage = nil
+	n.hashIndex.release()
+	return storage.abort()
+}
+
+//释放map占用的数据，对于以mmap方式打开的map会解除文件映射，对于尚未SetFinished的map相当于Abort,之后不能再查询
+func (n *NoGcStaticMapHuge) Close() error {
+	if !n.setFinished {
+		return n.Abort()
+	}
+	//索引与data一起清空，之后的查询只会返回不存在
+	n.data = nil
+	n.hashIndex.reset()
+	if n.mapped != nil {
+		mapped := n.mapped
+		n.mapped = nil
+		return munmapFile(mapped)
+	}
+	return nil
+}
+
+//遍历所有的键值对,fn返回false时停止遍历
+//警告:k,v是data中的引用，而非复制品，不要在外部改变k,v,需要在fn返回后继续使用时应自行复制
+func (n *NoGcStaticMapHuge) Range(fn func(k, v []byte) bool) {
+	if !n.setFinished {
+		panic("cant't Range before SetFinished")
+	}
+	for dataBeginPos := 0; dataBeginPos < len(n.data); {
+		k, v, next := n.recordAt(dataBeginPos)
+		//跳过被DuplicateKeepLast覆盖的键值对
+		if n.dead == 0 || n.isLive(k, dataBeginPos) {
+			if !fn(k, v) {
+				return
+			}
+		}
+		dataBeginPos = next
+	}
+}
+
+//判断某个位置上的键值对是否仍被索引指向
+func (n *NoGcStaticMapHuge) isLive(k []byte, dataBeginPos int) bool {
+	p, exist := n.find(k)
+	return exist && p == dataBeginPos
+}
@@ -0,0 +1,385 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/cespare/xxhash"
+	"io"
+	"math/bits"
+	"unsafe"
+)
+
+//当前平台是否为小端序，快照中的索引为小端序，只有小端序平台才能直接引用mmap的内容
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+//从快照中读取n个uint64 alias为true时直接引用b(mmap映射的区域)而不复制，多个进程共享同一份页缓存;
+//b未按8字节对齐或者平台不是小端序时仍然复制
+func readUint64s(b []byte, n int, alias bool) []uint64 {
+	if alias && littleEndian && n > 0 && uintptr(unsafe.Pointer(&b[0]))%8 == 0 {
+		return unsafe.Slice((*uint64)(unsafe.Pointer(&b[0])), n)
+	}
+	s := make([]uint64, n)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint64(b[i*8:])
+	}
+	return s
+}
+
+//从快照中读取n个uint32 同readUint64s
+func readUint32s(b []byte, n int, alias bool) []uint32 {
+	if alias && littleEndian && n > 0 && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), n)
+	}
+	s := make([]uint32, n)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return s
+}
+
+//键值对在data中的位置数组 默认每个位置占4个字节，data最大为4G;开启Offset64后每个位置占8字节
+type posArray struct {
+	u32 []uint32
+	u64 []uint64
+}
+
+//创建位置数组
+func newPosArray(count int, offset64 bool) posArray {
+	if offset64 {
+		return posArray{u64: make([]uint64, count)}
+	}
+	return posArray{u32: make([]uint32, count)}
+}
+
+//取出第i个位置
+func (p *posArray) get(i int) uint64 {
+	if p.u64 != nil {
+		return p.u64[i]
+	}
+	return uint64(p.u32[i])
+}
+
+//设置第i个位置
+func (p *posArray) set(i int, dataBeginPos uint64) {
+	if p.u64 != nil {
+		p.u64[i] = dataBeginPos
+	} else {
+		p.u32[i] = uint32(dataBeginPos)
+	}
+}
+
+//位置个数
+func (p *posArray) len() int {
+	if p.u64 != nil {
+		return len(p.u64)
+	}
+	return len(p.u32)
+}
+
+//占用的内存字节数
+func (p *posArray) size() int {
+	return len(p.u32)*4 + len(p.u64)*8
+}
+
+//把所有位置写入快照
+func (p *posArray) writeTo(w *bufio.Writer) error {
+	var buf [8]byte
+	for _, v := range p.u32 {
+		binary.LittleEndian.PutUint32(buf[:4], v)
+		if _, err := w.Write(buf[:4]); err != nil {
+			return err
+		}
+	}
+	for _, v := range p.u64 {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//从快照中读取count个位置，返回剩余未读取的内容 alias同readUint64s
+func readPosArray(b []byte, count uint64, offset64 bool, alias bool) (posArray, []byte, error) {
+	width := uint64(4)
+	if offset64 {
+		width = 8
+	}
+	if uint64(len(b))/width < count {
+		return posArray{}, nil, io.ErrUnexpectedEOF
+	}
+	var p posArray
+	if offset64 {
+		p.u64 = readUint64s(b, int(count), alias)
+	} else {
+		p.u32 = readUint32s(b, int(count), alias)
+	}
+	return p, b[count*width:], nil
+}
+
+//静态的开放寻址hash表，在SetFinished时一次性构建，之后只读
+//只由不含指针的切片组成，GC无需扫描，内存占用也是可以预估的
+//采用线性探测，装载因子不超过0.75
+type staticIndex struct {
+	shift uint8    //计算槽位时右移的位数,槽位数为 1<<(64-shift)
+	keys  []uint64 //槽位中存储的键，默认类型中为键的hash值，整型类型中为键本身
+	poses posArray //槽位中存储的键值对在data中的开始位置+1,0表示空槽
+}
+
+//根据键值对个数创建静态索引
+func newStaticIndex(count int, offset64 bool) staticIndex {
+	size := 1
+	for size < count+count/3+1 {
+		size = size << 1
+	}
+	return staticIndex{
+		shift: uint8(64 - bits.TrailingZeros(uint(size))),
+		keys:  make([]uint64, size),
+		poses: newPosArray(size, offset64),
+	}
+}
+
+//计算键的第一个槽位 斐波那契散列,对整型键也能分布均匀
+func (x *staticIndex) slot(k uint64) int {
+	return int((k * 0x9E3779B97F4A7C15) >> x.shift)
+}
+
+//插入键以及键值对在data中的位置,相同的键可以插入多次(hash冲突的情况)
+func (x *staticIndex) insert(k uint64, dataBeginPos uint64) {
+	mask := len(x.keys) - 1
+	i := x.slot(k)
+	for x.poses.get(i) != 0 {
+		i = (i + 1) & mask
+	}
+	x.keys[i] = k
+	x.poses.set(i, dataBeginPos+1)
+}
+
+//查找键,对于每个键相同的槽位调用match确认data中的键是否真的相同
+func (x *staticIndex) find(k uint64, match func(dataBeginPos int) bool) (int, bool) {
+	if len(x.keys) == 0 {
+		return 0, false
+	}
+	mask := len(x.keys) - 1
+	for i := x.slot(k); ; i = (i + 1) & mask {
+		p := x.poses.get(i)
+		if p == 0 {
+			return 0, false
+		}
+		if x.keys[i] == k && match(int(p-1)) {
+			return int(p - 1), true
+		}
+	}
+}
+
+//查找键,键本身就存储在索引中的情况下使用,无需再比较data中的内容
+func (x *staticIndex) findExact(k uint64) (int, bool) {
+	if len(x.keys) == 0 {
+		return 0, false
+	}
+	mask := len(x.keys) - 1
+	for i := x.slot(k); ; i = (i + 1) & mask {
+		p := x.poses.get(i)
+		if p == 0 {
+			return 0, false
+		}
+		if x.keys[i] == k {
+			return int(p - 1), true
+		}
+	}
+}
+
+//索引中键的个数
+func (x *staticIndex) count() int {
+	c := 0
+	for i := 0; i < x.poses.len(); i++ {
+		if x.poses.get(i) != 0 {
+			c = c + 1
+		}
+	}
+	return c
+}
+
+//hash值与之前的某个键相同的键的个数
+//线性探测且没有删除，hash值相同的键都在从其起始槽位开始的连续区间中，只需向前查找到起始槽位
+func (x *staticIndex) collisions() int {
+	c := 0
+	mask := len(x.keys) - 1
+	for i := range x.keys {
+		if x.poses.get(i) == 0 {
+			continue
+		}
+		for j := x.slot(x.keys[i]); j != i; j = (j + 1) & mask {
+			if x.keys[j] == x.keys[i] {
+				c = c + 1
+				break
+			}
+		}
+	}
+	return c
+}
+
+//索引占用的内存字节数
+func (x *staticIndex) size() int {
+	return len(x.keys)*8 + x.poses.size()
+}
+
+//把索引写入快照 槽位数(8字节) 之后为各槽位的键以及各槽位的位置
+func (x *staticIndex) writeTo(w *bufio.Writer) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(x.keys)))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	for _, k := range x.keys {
+		binary.LittleEndian.PutUint64(buf[:], k)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return x.poses.writeTo(w)
+}
+
+//从快照中读取writeTo写入的索引 alias为true时直接引用b,见readUint64s
+func readStaticIndex(b []byte, offset64 bool, alias bool) (x staticIndex, err error) {
+	if len(b) < 8 {
+		return x, io.ErrUnexpectedEOF
+	}
+	size := binary.LittleEndian.Uint64(b[0:8])
+	b = b[8:]
+	if size == 0 || size&(size-1) != 0 {
+		return x, errors.New("invalid index size in snapshot")
+	}
+	if uint64(len(b))/8 < size {
+		return x, io.ErrUnexpectedEOF
+	}
+	x.shift = uint8(64 - bits.TrailingZeros64(size))
+	x.keys = readUint64s(b, int(size), alias)
+	x.poses, _, err = readPosArray(b[size*8:], size, offset64, alias)
+	return x, err
+}
+
+//默认类型及Huge类型共用的索引 构建期间按键的hash值记录位置，SetFinished时转换为开放寻址或者最小完美hash的静态索引;
+//不同的键的hash值可能相同，查找时需要比较键的内容
+type hashIndex struct {
+	index               [512]map[uint64]uint64 //构建期间使用,SetFinished后释放,值为切片data []byte中的某个位置,此索引存储无hash冲突的key的hash值以及有hash冲突但是是第1次出现的key的hash值
+	mapForHashCollision map[string]uint64      //构建期间使用,SetFinished后释放,值为切片data []byte中的某个位置,string为存放有hash冲突的第2次或2次以上出现的key,这个map一般来说是非常小的
+	indexType           IndexType              //SetFinished后使用的索引类型
+	table               staticIndex            //SetFinished时构建的开放寻址索引,包含所有的键
+	perfect             mphIndex               //SetFinished时构建的最小完美hash索引,包含所有的键
+}
+
+//创建构建期间使用的map
+func (x *hashIndex) initBuild(indexType IndexType) {
+	x.mapForHashCollision = make(map[string]uint64)
+	for i := range x.index {
+		x.index[i] = make(map[uint64]uint64)
+	}
+	x.indexType = indexType
+}
+
+//从静态索引中查找hash值为h并且match返回true的键的位置
+func (x *hashIndex) search(h uint64, match func(dataBeginPos int) bool) (int, bool) {
+	if x.indexType == IndexMinimalPerfectHash {
+		return x.perfect.find(h, match)
+	}
+	return x.table.find(h, match)
+}
+
+//取出构建期间记录的所有键的hash值及其位置，之后释放构建期间使用的map
+func (x *hashIndex) collect(count int) (hashes, poses []uint64) {
+	hashes = make([]uint64, 0, count)
+	poses = make([]uint64, 0, count)
+	for i := range x.index {
+		for h, dataBeginPos := range x.index[i] {
+			hashes = append(hashes, h)
+			poses = append(poses, dataBeginPos)
+		}
+		x.index[i] = nil
+	}
+	for k, dataBeginPos := range x.mapForHashCollision {
+		hashes = append(hashes, xxhash.Sum64String(k))
+		poses = append(poses, dataBeginPos)
+	}
+	x.mapForHashCollision = nil
+	return hashes, poses
+}
+
+//根据键的hash值及其位置构建静态索引
+func (x *hashIndex) build(hashes, poses []uint64, offset64 bool) {
+	if x.indexType == IndexMinimalPerfectHash {
+		x.perfect = newMphIndex(hashes, poses, offset64)
+		return
+	}
+	x.table = newStaticIndex(len(hashes), offset64)
+	for i := range hashes {
+		x.table.insert(hashes[i], poses[i])
+	}
+}
+
+//释放构建期间使用的map
+func (x *hashIndex) release() {
+	for i := range x.index {
+		x.index[i] = nil
+	}
+	x.mapForHashCollision = nil
+}
+
+//清空静态索引，之后的查询只会返回不存在
+func (x *hashIndex) reset() {
+	x.table = staticIndex{}
+	x.perfect = mphIndex{}
+}
+
+//把静态索引写入快照
+func (x *hashIndex) writeTo(w *bufio.Writer) error {
+	if x.indexType == IndexMinimalPerfectHash {
+		return x.perfect.writeTo(w)
+	}
+	return x.table.writeTo(w)
+}
+
+//从快照中读取静态索引 alias同readUint64s
+func (x *hashIndex) read(b []byte, offset64 bool, alias bool) (err error) {
+	if x.indexType == IndexMinimalPerfectHash {
+		x.perfect, err = readMphIndex(b, offset64, alias)
+	} else {
+		x.table, err = readStaticIndex(b, offset64, alias)
+	}
+	return err
+}
+
+//静态索引中键的个数
+func (x *hashIndex) count() int {
+	if x.indexType == IndexMinimalPerfectHash {
+		return x.perfect.count()
+	}
+	return x.table.count()
+}
+
+//统计索引占用的字节数以及hash值与之前的某个键相同的键的个数 finished为false时为构建期间使用的map的估算值
+func (x *hashIndex) stats(s *Stats, finished bool) {
+	switch {
+	case !finished:
+		s.IndexBytes = estimateMapBytes(countEntries(&x.index), 16) + estimateMapBytes(len(x.mapForHashCollision), 24)
+		for k := range x.mapForHashCollision {
+			s.IndexBytes = s.IndexBytes + len(k)
+		}
+		s.Collisions = len(x.mapForHashCollision)
+	case x.indexType == IndexMinimalPerfectHash:
+		s.IndexBytes = x.perfect.size()
+		s.Collisions = x.perfect.collisions()
+	default:
+		s.IndexBytes = x.table.size()
+		s.Collisions = x.table.collisions()
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"testing"
+)
+
+func TestStaticIndex(t *testing.T) {
+	x := newStaticIndex(10000, false)
+	for i := 0; i < 10000; i++ {
+		x.insert(uint64(i), uint64(i*10))
+	}
+	//模拟hash冲突，相同的键对应不同的位置
+	x.insert(7, 123456)
+	for i := 0; i < 10000; i++ {
+		dataBeginPos, exist := x.findExact(uint64(i))
+		if !exist || dataBeginPos != i*10 {
+			t.Fatalf("unexpected value obtained; got %v want %v", dataBeginPos, i*10)
+		}
+	}
+	dataBeginPos, exist := x.find(7, func(dataBeginPos int) bool { return dataBeginPos == 123456 })
+	if !exist || dataBeginPos != 123456 {
+		t.Fatalf("unexpected value obtained; got %v want %v", dataBeginPos, 123456)
+	}
+	if _, exist := x.findExact(10000); exist {
+		t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+	}
+	//空索引
+	empty := newStaticIndex(0, false)
+	if _, exist := empty.findExact(0); exist {
+		t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+	}
+}
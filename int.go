@@ -6,85 +6,157 @@
 package noGcStaticMap
 
 import (
-	"bufio"
-	"io/ioutil"
-	"os"
-	"strconv"
+	"encoding/binary"
+	"math"
+	"unsafe"
 )
 
 type NoGcStaticMapInt struct {
-	setFinished  bool //是否完成存储
-	dataBeginPos int  //游标，记录位置
-	len          int  //记录键值对个数
-	bw           *bufio.Writer
-	tempFile     *os.File            //硬盘上的临时文件
-	tempFileName string              //临时文件名
+	setFinished  bool                //是否完成存储
+	offset64     bool                //索引中的位置是否使用8个字节,即data是否可以超过4G
+	dataBeginPos int                 //游标，记录位置
+	len          int                 //记录键值对个数
+	dead         int                 //被DuplicateKeepLast覆盖的键值对个数,这些键值对仍在data中，但索引不再指向它们
+	duplicate    DuplicatePolicy     //遇到重复的键的处理方式
+	storage      *buildStorage       //构建期间存放键值对的地方,SetFinished后释放
 	data         []byte              //存储值的内容
-	index        [512]map[int]uint32 //值为切片data []byte中的某个位置
+	mapped       []byte              //以mmap方式打开快照时映射的文件内容
+	metrics      *Metrics            //查询的统计指标,为nil时不统计
+	checksum     uint64              //从快照加载时快照中记录的data的校验和,用于Verify
+	hasChecksum  bool                //快照中是否记录了data的校验和
+	index        [512]map[int]uint64 //构建期间使用,SetFinished后释放,值为切片data []byte中的某个位置
+	table        staticIndex         //SetFinished时构建的静态索引,直接存储键本身
 }
 
 //初始化 键的类型为int,值的最大长度为65535，与默认类型相比，速度稍快，稍微节省存储空间
 func NewInt(tempFileName ...string) *NoGcStaticMapInt {
+	return NewIntWithOptions(optionsFromTempFileName(tempFileName))
+}
+
+//按初始化参数初始化 索引中直接存储键本身，opt.Index不起作用
+func NewIntWithOptions(opt Options) *NoGcStaticMapInt {
+	n, err := TryNewIntWithOptions(opt)
+	haserrPanic(err)
+	return n
+}
+
+//按初始化参数初始化 创建临时文件失败时返回错误而不是panic,适用于只读的容器等可能无法写硬盘的场景
+func TryNewIntWithOptions(opt Options) (*NoGcStaticMapInt, error) {
 	var n NoGcStaticMapInt
 	for i := range n.index {
-		n.index[i] = make(map[int]uint32)
+		n.index[i] = make(map[int]uint64)
+	}
+	n.offset64 = opt.Offset64
+	n.duplicate = opt.Duplicate
+	storage, err := newBuildStorage(opt)
+	if err != nil {
+		return nil, err
 	}
-	n.tempFileName, n.tempFile, n.bw = createTempFile(tempFileName...)
-	return &n
+	n.storage = storage
+	return &n, nil
 }
 
 //取出数据
 func (n *NoGcStaticMapInt) Get(k int) (v []byte, exist bool) {
-	if !n.setFinished {
-		panic("cant't Get before SetFinished")
-	}
-	idx := k % 512
-	dataBeginPos, exist := n.index[idx][k]
-
+	dataBeginPos, exist := n.GetDataBeginPosOfKVPair64(k)
 	if exist {
 		return n.read(int(dataBeginPos)), true
 	}
 	return v, false
 }
 
+//取出数据,在SetFinished之前调用时返回ErrNotFinished而不是panic
+func (n *NoGcStaticMapInt) TryGet(k int) (v []byte, exist bool, err error) {
+	if !n.setFinished {
+		return nil, false, ErrNotFinished
+	}
+	v, exist = n.Get(k)
+	return v, exist, nil
+}
+
 //取出数据 警告:返回的数据是hash表中值的引用，而非值的复制品，要注意不要在外部改变该返回值s
 func (n *NoGcStaticMapInt) GetUnsafe(k int) (v []byte, exist bool) {
-	dataBeginPos, exist := n.GetDataBeginPosOfKVPair(k)
+	dataBeginPos, exist := n.GetDataBeginPosOfKVPair64(k)
 	if !exist {
 		return nil, false
 	}
 	return n.GetValFromDataBeginPosOfKVPairUnSafe(int(dataBeginPos)), true
 }
 
+//取出数据并追加到dst之后返回，复用dst可以避免每次分配内存，返回的数据不会引用map内部的数据，键不存在时原样返回dst
+func (n *NoGcStaticMapInt) AppendValue(dst []byte, k int) ([]byte, bool) {
+	v, exist := n.GetUnsafe(k)
+	if !exist {
+		return dst, false
+	}
+	return append(dst, v...), true
+}
+
 //取出数据,以string的方式
 func (n *NoGcStaticMapInt) GetString(k int) (v string, exist bool) {
-	vbyte, exist := n.Get(k)
+	val, exist := n.GetUnsafe(k)
 	if exist {
-		return string(vbyte), true
+		return string(val), true
 	}
 	return v, false
 }
 
+//取出数据,以string的方式 警告:返回的string直接引用map内部的数据，不能在Close之后继续使用
+func (n *NoGcStaticMapInt) GetStringUnsafe(k int) (v string, exist bool) {
+	val, exist := n.GetUnsafe(k)
+	if !exist || len(val) == 0 {
+		return v, exist
+	}
+	return unsafe.String(&val[0], len(val)), true
+}
+
 //取出键值对在数据中存储的开始位置
 func (n *NoGcStaticMapInt) GetDataBeginPosOfKVPair(k int) (uint32, bool) {
 	if !n.setFinished {
 		panic("cant't Get before SetFinished")
 	}
-	idx := k % 512
-	//这里无需校检键是否正确，故直接返回
-	dataBeginPos, exist := n.index[idx][k]
+	//索引中存储的是键本身，无需再校检键是否正确，故直接返回
+	dataBeginPos, exist := n.lookup(k)
+	if uint64(dataBeginPos) > math.MaxUint32 {
+		panic("dataBeginPos is larger than 4GB, please use GetDataBeginPosOfKVPair64")
+	}
+	return uint32(dataBeginPos), exist
+}
+
+//取出键值对在数据中存储的开始位置,data超过4G(Offset64)时使用
+func (n *NoGcStaticMapInt) GetDataBeginPosOfKVPair64(k int) (uint64, bool) {
+	if !n.setFinished {
+		panic("cant't Get before SetFinished")
+	}
+	dataBeginPos, exist := n.lookup(k)
+	return uint64(dataBeginPos), exist
+}
+
+//查找键在data中的位置,设置了Metrics时记录是否命中以及延迟
+func (n *NoGcStaticMapInt) lookup(k int) (int, bool) {
+	if n.metrics == nil {
+		return n.find(k)
+	}
+	start := n.metrics.start()
+	dataBeginPos, exist := n.find(k)
+	n.metrics.observe(start, exist)
 	return dataBeginPos, exist
 }
 
+//从索引中查找键在data中的位置 索引中存储的是键本身，无需比较键的内容
+func (n *NoGcStaticMapInt) find(k int) (int, bool) {
+	return n.table.findExact(uint64(k))
+}
+
 //从内存中的某个位置取出键值对中值的数据
 //警告:
 //1)传入的dataBeginPos必须是真实有效的，否则有可能会数据越界;
 //2)返回的数据是hash表中值的引用，而非值的复制品，要注意不要在外部改变该返回值
 func (n *NoGcStaticMapInt) GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos int) (v []byte) {
-	//读取键值的长度
+	//跳过键，读取值的长度
+	dataBeginPos = dataBeginPos + 8
 	kvLenBuf := n.data[dataBeginPos : dataBeginPos+2]
 	valLen := (uint64(kvLenBuf[0]) << 8) | uint64(kvLenBuf[1])
-	//读取键的内容，并判断键是否相同
 	dataBeginPos = dataBeginPos + 2
 	//读取值并返回
 	if valLen == 0 {
@@ -95,25 +167,48 @@ func (n *NoGcStaticMapInt) GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos int
 
 //增加数据
 func (n *NoGcStaticMapInt) Set(k int, v []byte) {
-	n.len = n.len + 1
+	if err := n.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加数据,出错时返回*KeyError而不是panic
+func (n *NoGcStaticMapInt) TrySet(k int, v []byte) error {
 	//键值设置完之后，不允许再添加
 	if n.setFinished {
-		panic("can't Set after SetFinished")
+		return newKeyError(k, ErrFinished)
+	}
+	if n.storage == nil {
+		return newKeyError(k, ErrAborted)
 	}
-	idx := k % 512
+	//转换成无符号数再取模，负数的键也能得到正确的分区
+	idx := uint64(k) % 512
 	//判断键值的长度，不允许太长
 	if len(v) > 65535 {
-		panic("k or v is too long,The maximum is 65535")
+		return newKeyError(k, ErrValueTooLarge)
 	}
-
-	_, exist := n.index[idx][k]
-	if exist {
-		panic("can't add the key '" + strconv.Itoa(k) + "' for twice")
-	} else {
-		n.index[idx][k] = uint32(n.dataBeginPos)
+	//索引中的位置默认只占4个字节，data超过4G时无法表示
+	if !n.offset64 && uint64(n.dataBeginPos) >= math.MaxUint32 {
+		return newKeyError(k, ErrDataTooLarge)
+	}
+	_, duplicate := n.index[idx][k]
+	if duplicate {
+		if skip, err := n.duplicate.handle(k); skip {
+			return err
+		}
 	}
 	//存储数据到临时文件，并且移动游标
-	n.write(v)
+	dataBeginPos := uint64(n.dataBeginPos)
+	if err := n.write(k, v); err != nil {
+		return newKeyError(k, err)
+	}
+	n.index[idx][k] = dataBeginPos
+	if duplicate {
+		n.dead = n.dead + 1
+	} else {
+		n.len = n.len + 1
+	}
+	return nil
 }
 
 //增加数据,以string的方式
@@ -123,57 +218,211 @@ func (n *NoGcStaticMapInt) SetString(k int, v string) {
 
 //从内存中读取相应数据
 func (n *NoGcStaticMapInt) read(dataBeginPos int) (v []byte) {
-	//读取键值的长度
-	kvLenBuf := n.data[dataBeginPos : dataBeginPos+2]
-	valLen := (uint64(kvLenBuf[0]) << 8) | uint64(kvLenBuf[1])
-	//读取键的内容，并判断键是否相同
-	dataBeginPos = dataBeginPos + 2
+	val := n.GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos)
 	//读取值并返回
-	if valLen == 0 {
+	if len(val) == 0 {
 		return nil
 	}
-	v = make([]byte, 0, int(valLen))
-	v = append(v, n.data[dataBeginPos:dataBeginPos+int(valLen)]...)
+	v = make([]byte, 0, len(val))
+	v = append(v, val...)
 	return v
 }
 
-//往文件中写入数据
-func (n *NoGcStaticMapInt) write(v []byte) {
-	dataLen := 2 + len(v) //2个字节表示V的长度
-	//直接从fastcache复制过来
-	var kvLenBuf [2]byte
-	kvLenBuf[0] = byte(uint16(len(v)) >> 8)
-	kvLenBuf[1] = byte(len(v))
-	//写入v的长度
-	_, err := n.bw.Write(kvLenBuf[:])
-	haserrPanic(err)
+//读取某个位置上的键值对，返回键，值以及下一个键值对的位置 值是data中的引用
+func (n *NoGcStaticMapInt) recordAt(dataBeginPos int) (k int, v []byte, next int) {
+	k = int(binary.LittleEndian.Uint64(n.data[dataBeginPos : dataBeginPos+8]))
+	v = n.GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos)
+	return k, v, dataBeginPos + 8 + 2 + len(v)
+}
+
+//往文件中写入数据 键占8个字节,之后2个字节表示V的长度
+func (n *NoGcStaticMapInt) write(k int, v []byte) error {
+	dataLen := 8 + 2 + len(v)
+	var kvLenBuf [10]byte
+	binary.LittleEndian.PutUint64(kvLenBuf[0:8], uint64(k))
+	kvLenBuf[8] = byte(uint16(len(v)) >> 8)
+	kvLenBuf[9] = byte(len(v))
+	//写入k以及v的长度
+	if _, err := n.storage.Write(kvLenBuf[:]); err != nil {
+		return err
+	}
 	//写入V
-	for i := range v {
-		err = n.bw.WriteByte(v[i])
-		haserrPanic(err)
+	if _, err := n.storage.Write(v); err != nil {
+		return err
 	}
 	//写完了，移动游标
 	n.dataBeginPos = n.dataBeginPos + dataLen
+	return nil
 }
 
 //完成存储把存储到硬盘上的文件复制到内存
 func (n *NoGcStaticMapInt) SetFinished() {
+	haserrPanic(n.Finish())
+}
+
+//完成存储,出错时返回错误而不是panic
+func (n *NoGcStaticMapInt) Finish() error {
+	r, err := n.finishBuild()
+	if err != nil {
+		return err
+	}
+	n.buildIndex(r.keys, r.poses)
+	return nil
+}
+
+//结束构建，把构建期间存储的键值对读入data,返回data以及所有的键及其位置
+func (n *NoGcStaticMapInt) finishBuild() (buildResult, error) {
+	if n.setFinished {
+		return buildResult{}, ErrFinished
+	}
+	if n.storage == nil {
+		return buildResult{}, ErrAborted
+	}
+	b, err := n.storage.finish()
+	if err != nil {
+		//storage.finish出错时已经删除了临时文件，这里释放构建期间的map,之后的Set返回ErrAborted
+		n.Abort()
+		return buildResult{}, err
+	}
 	n.setFinished = true
-	err := n.bw.Flush()
-	haserrPanic(err)
-	if n.tempFile != nil {
-		err = n.tempFile.Close()
-		haserrPanic(err)
+	n.data = b
+	n.storage = nil
+	//收集所有的键及其位置，之后构建期间使用的map就不再需要了
+	keys := make([]uint64, 0, n.len)
+	poses := make([]uint64, 0, n.len)
+	for i := range n.index {
+		for k, dataBeginPos := range n.index[i] {
+			keys = append(keys, uint64(k))
+			poses = append(poses, dataBeginPos)
+		}
+		n.index[i] = nil
+	}
+	return buildResult{data: n.data, keys: keys, poses: poses, len: n.len, dead: n.dead}, nil
+}
+
+//根据键及其位置构建静态索引
+func (n *NoGcStaticMapInt) buildIndex(keys []uint64, poses []uint64) {
+	n.table = newStaticIndex(len(keys), n.offset64)
+	for i := range keys {
+		n.table.insert(keys[i], poses[i])
 	}
-	b, err := ioutil.ReadFile(n.tempFileName)
-	haserrPanic(err)
-	n.data = make([]byte, 0, len(b))
-	n.data = append(n.data, b...)
-	err = os.Remove(n.tempFileName)
-	haserrPanic(err)
 }
 
 //返回键值对个数
 func (n *NoGcStaticMapInt) Len() int {
 	return n.len
 }
+
+//是否已完成存储
+func (n *NoGcStaticMapInt) finished() bool {
+	return n.setFinished
+}
+
+//把已完成存储的数据及索引保存到快照文件，之后可以用LoadInt直接加载，无需再次Set
+func (n *NoGcStaticMapInt) SaveToFile(fileName string) error {
+	if !n.setFinished {
+		return errNotFinishedForSave
+	}
+	h := snapshotHeader{kind: kindInt, offset64: n.offset64, len: n.len, dead: n.dead}
+	return saveSnapshot(fileName, h, n.data, n.table.writeTo)
+}
+
+//从SaveToFile保存的快照文件中加载，加载后即可直接查询
+func LoadInt(fileName string) (*NoGcStaticMapInt, error) {
+	h, data, index, err := loadSnapshot(fileName, kindInt)
+	if err != nil {
+		return nil, err
+	}
+	return newIntFromSnapshot(h, data, index, false)
+}
+
+//以mmap的方式只读打开SaveToFile保存的快照文件，data及索引直接引用映射的文件内容而不复制到堆上(大端序平台上索引仍需复制),
+//多个进程打开同一文件时可共享操作系统的页缓存。不再使用时应调用Close释放映射
+func LoadIntMmap(fileName string) (*NoGcStaticMapInt, error) {
+	h, data, index, mapped, err := mmapSnapshot(fileName, kindInt)
+	if err != nil {
+		return nil, err
+	}
+	n, err := newIntFromSnapshot(h, data, index, true)
+	if err != nil {
+		munmapFile(mapped)
+		return nil, err
+	}
+	n.mapped = mapped
+	return n, nil
+}
+
+//根据快照内容初始化
+func newIntFromSnapshot(h snapshotHeader, data, index []byte, mapped bool) (*NoGcStaticMapInt, error) {
+	var n NoGcStaticMapInt
+	n.data = data
+	n.len = h.len
+	n.dead = h.dead
+	n.checksum = h.checksum
+	n.hasChecksum = h.hasChecksum
+	n.dataBeginPos = len(data)
+	n.setFinished = true
+	n.offset64 = h.offset64
+	table, err := readStaticIndex(index, n.offset64, mapped)
+	if err != nil {
+		return nil, err
+	}
+	n.table = table
+	return &n, nil
+}
+
+//放弃构建并删除临时文件，之后不能再Set以及SetFinished,构建失败或者不再需要时调用，可以用defer保证进程panic时也能删除
+func (n *NoGcStaticMapInt) Abort() error {
+	if n.setFinished {
+		return ErrFinished
+	}
+	if n.storage == nil {
+		return nil
+	}
+	storage := n.storage
+	n.storage = nil
+	for i := range n.index {
+		n.index[i] = nil
+	}
+	return storage.abort()
+}
+
+//释放map占用的数据，对于以mmap方式打开的map会解除文件映射，对于尚未SetFinished的map相当于Abort,之后不能再查询
+func (n *NoGcStaticMapInt) Close() error {
+	if !n.setFinished {
+		return n.Abort()
+	}
+	//索引与data一起清空，之后的查询只会返回不存在
+	n.data = nil
+	n.table = staticIndex{}
+	if n.mapped != nil {
+		mapped := n.mapped
+		n.mapped = nil
+		return munmapFile(mapped)
+	}
+	return nil
+}
+
+//遍历所有的键值对,fn返回false时停止遍历
+//警告:v是data中的引用，而非值的复制品，不要在外部改变v,需要在fn返回后继续使用时应自行复制
+func (n *NoGcStaticMapInt) Range(fn func(k int, v []byte) bool) {
+	if !n.setFinished {
+		panic("cant't Range before SetFinished")
+	}
+	for dataBeginPos := 0; dataBeginPos < len(n.data); {
+		k, v, next := n.recordAt(dataBeginPos)
+		//跳过被DuplicateKeepLast覆盖的键值对
+		if n.dead == 0 || n.isLive(k, dataBeginPos) {
+			if !fn(k, v) {
+				return
+			}
+		}
+		dataBeginPos = next
+	}
+}
+
+//判断某个位置上的键值对是否仍被索引指向
+func (n *NoGcStaticMapInt) isLive(k int, dataBeginPos int) bool {
+	p, exist := n.find(k)
+	return exist && p == dataBeginPos
+}
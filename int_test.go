@@ -6,6 +6,8 @@
 package noGcStaticMap
 
 import (
+	"math"
+	"path/filepath"
 	"strconv"
 	"testing"
 )
@@ -31,3 +33,37 @@ func TestInt(t *testing.T) {
 		}
 	}
 }
+
+func TestIntNegative(t *testing.T) {
+	//64位平台上math.MinInt,math.MaxInt即为int64的最小值和最大值
+	var keys = []int{-1, -511, -512, -513, -1000000, math.MinInt, math.MaxInt, 0, 1}
+	var m = NewInt("mapIntNegativeForTest")
+	for _, k := range keys {
+		m.SetString(k, strconv.Itoa(k))
+	}
+	m.SetFinished()
+	for _, k := range keys {
+		val, exist := m.GetString(k)
+		if !exist || val != strconv.Itoa(k) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(k))
+		}
+	}
+	if _, exist := m.GetString(-2); exist {
+		t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+	}
+	//快照
+	fileName := filepath.Join(t.TempDir(), "int.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadInt(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		val, exist := loaded.GetString(k)
+		if !exist || val != strconv.Itoa(k) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(k))
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+
+//go:build go1.23
+
+package noGcStaticMap
+
+import (
+	"iter"
+)
+
+//以iter.Seq2的方式遍历所有的键值对，可以用于for range,键值的引用规则与Range相同
+func (n *NoGcStaticMapAny) All() iter.Seq2[[]byte, []byte] {
+	return n.Range
+}
+
+//以iter.Seq2的方式遍历所有的键值对，可以用于for range,键值的引用规则与Range相同
+func (n *NoGcStaticMapHuge) All() iter.Seq2[[]byte, []byte] {
+	return n.Range
+}
+
+//以iter.Seq2的方式遍历所有的键值对，可以用于for range,值的引用规则与Range相同
+func (n *NoGcStaticMapInt) All() iter.Seq2[int, []byte] {
+	return n.Range
+}
+
+//以iter.Seq2的方式遍历所有的键值对，可以用于for range,值的引用规则与Range相同
+func (n *NoGcStaticMapUint32) All() iter.Seq2[uint32, []byte] {
+	return n.Range
+}
+
+//以iter.Seq2的方式遍历所有的键值对，可以用于for range
+func (n *NoGcStaticMap[K, V]) All() iter.Seq2[K, V] {
+	return n.Range
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+
+//go:build go1.23
+
+package noGcStaticMap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	m := NewInt("mapIntAllForTest")
+	for i := 0; i < 1000; i++ {
+		m.SetString(i, strconv.Itoa(i))
+	}
+	m.SetFinished()
+	count := 0
+	for k, v := range m.All() {
+		if strconv.Itoa(k) != string(v) {
+			t.Fatalf("unexpected value obtained; got %q want %q", v, strconv.Itoa(k))
+		}
+		count++
+		if count == 500 {
+			break
+		}
+	}
+	if count != 500 {
+		t.Fatalf("unexpected count obtained; got %v want %v", count, 500)
+	}
+	g := NewGeneric[string, int64](StringCodec{}, IntegerCodec[int64]{}, Options{TempFileName: "mapGenericAllForTest"})
+	for i := 0; i < 1000; i++ {
+		g.Set(strconv.Itoa(i), int64(i))
+	}
+	g.SetFinished()
+	count = 0
+	for k, v := range g.All() {
+		if k != strconv.Itoa(int(v)) {
+			t.Fatalf("unexpected value obtained; got %v want %v", v, k)
+		}
+		count++
+	}
+	if count != 1000 {
+		t.Fatalf("unexpected count obtained; got %v want %v", count, 1000)
+	}
+}
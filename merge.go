@@ -0,0 +1,118 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+//合并多个map时的参数
+type MergeOptions[K any] struct {
+	//合并后的map的初始化参数，其中Duplicate为多个map中都存在的键的处理方式:
+	//DuplicateError时返回ErrDuplicateKey,DuplicateKeepFirst保留第一个map中的值,DuplicateKeepLast保留最后一个map中的值
+	Options
+	//不为nil时按map的顺序依次合并同一个键的各个值，优先于Duplicate
+	//old,new可能是map内部数据的引用，不能修改，也不能在返回后继续引用
+	Combine func(k K, old, new []byte) []byte
+}
+
+//合并时的源map
+type mergeSource[K any] interface {
+	Range(fn func(k K, v []byte) bool)
+	GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos int) []byte
+	find(k K) (int, bool)
+	finished() bool
+}
+
+//在源map中查找键，返回值在data中的引用 使用不记录Metrics的find,合并及比较不会影响源map的统计指标
+func sourceValue[K any, M mergeSource[K]](m M, k K) ([]byte, bool) {
+	dataBeginPos, exist := m.find(k)
+	if !exist {
+		return nil, false
+	}
+	return m.GetValFromDataBeginPosOfKVPairUnSafe(dataBeginPos), true
+}
+
+//合并时的目标map
+type mergeTarget[K any] interface {
+	TrySet(k K, v []byte) error
+	Finish() error
+	Abort() error
+}
+
+//按顺序遍历各个map的data,每个键只在第一次出现时写入dst,写入前在之后的map中查找同一个键并按opt处理
+//各map中的键本身都是唯一的，因此dst中不会出现重复的键，也不会有被覆盖的键值对占用空间
+func mergeMaps[K any, M mergeSource[K]](opt MergeOptions[K], dst mergeTarget[K], maps []M) error {
+	var err error
+	for i := range maps {
+		maps[i].Range(func(k K, v []byte) bool {
+			for j := 0; j < i; j++ {
+				if _, exist := maps[j].find(k); exist {
+					return true
+				}
+			}
+			for j := i + 1; j < len(maps) && (opt.Combine != nil || opt.Duplicate != DuplicateKeepFirst); j++ {
+				other, exist := sourceValue[K](maps[j], k)
+				if !exist {
+					continue
+				}
+				switch {
+				case opt.Combine != nil:
+					v = opt.Combine(k, v, other)
+				case opt.Duplicate == DuplicateKeepLast:
+					v = other
+				default:
+					err = newKeyError(k, ErrDuplicateKey)
+					return false
+				}
+			}
+			err = dst.TrySet(k, v)
+			return err == nil
+		})
+		if err != nil {
+			dst.Abort()
+			return err
+		}
+	}
+	return dst.Finish()
+}
+
+//合并多个已完成存储的map的公共部分 newMap用于创建合并后的map
+func mergeNew[K any, M mergeSource[K], T mergeTarget[K]](opt MergeOptions[K], maps []M, newMap func(Options) (T, error)) (T, error) {
+	var zero T
+	for _, m := range maps {
+		if !m.finished() {
+			return zero, ErrNotFinished
+		}
+	}
+	//各map中的键在写入前已经去重
+	dstOpt := opt.Options
+	dstOpt.Duplicate = DuplicateError
+	n, err := newMap(dstOpt)
+	if err != nil {
+		return zero, err
+	}
+	if err = mergeMaps[K](opt, n, maps); err != nil {
+		return zero, err
+	}
+	return n, nil
+}
+
+//把多个已完成存储的默认类型的map合并为一个新的map,源map不受影响
+func Merge(opt MergeOptions[[]byte], maps ...*NoGcStaticMapAny) (*NoGcStaticMapAny, error) {
+	return mergeNew(opt, maps, TryNewDefaultWithOptions)
+}
+
+//把多个已完成存储的Huge类型的map合并为一个新的map,源map不受影响
+func MergeHuge(opt MergeOptions[[]byte], maps ...*NoGcStaticMapHuge) (*NoGcStaticMapHuge, error) {
+	return mergeNew(opt, maps, TryNewHugeWithOptions)
+}
+
+//把多个已完成存储的int类型的map合并为一个新的map,源map不受影响
+func MergeInt(opt MergeOptions[int], maps ...*NoGcStaticMapInt) (*NoGcStaticMapInt, error) {
+	return mergeNew(opt, maps, TryNewIntWithOptions)
+}
+
+//把多个已完成存储的uint32类型的map合并为一个新的map,源map不受影响
+func MergeUint32(opt MergeOptions[uint32], maps ...*NoGcStaticMapUint32) (*NoGcStaticMapUint32, error) {
+	return mergeNew(opt, maps, TryNewUint32WithOptions)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	//3个map中的键分别为[0,1000),[500,1500),[1000,2000)
+	maps := make([]*NoGcStaticMapAny, 3)
+	mapsInt := make([]*NoGcStaticMapInt, 3)
+	for i := range maps {
+		maps[i] = NewDefaultWithOptions(Options{InMemory: true})
+		mapsInt[i] = NewIntWithOptions(Options{InMemory: true})
+		for k := i * 500; k < i*500+1000; k++ {
+			maps[i].SetString(strconv.Itoa(k), strconv.Itoa(i))
+			mapsInt[i].SetString(k, strconv.Itoa(i))
+		}
+		maps[i].SetFinished()
+		mapsInt[i].SetFinished()
+	}
+	for _, c := range []struct {
+		opt  MergeOptions[[]byte]
+		want []string //键0,500,1000,1999对应的值
+	}{
+		{MergeOptions[[]byte]{Options: Options{InMemory: true, Duplicate: DuplicateKeepFirst}}, []string{"0", "0", "1", "2"}},
+		{MergeOptions[[]byte]{Options: Options{InMemory: true, Duplicate: DuplicateKeepLast}}, []string{"0", "1", "2", "2"}},
+		{MergeOptions[[]byte]{Options: Options{InMemory: true}, Combine: func(k, old, new []byte) []byte {
+			return append(append(append([]byte(nil), old...), '+'), new...)
+		}}, []string{"0", "0+1", "1+2", "2"}},
+	} {
+		m, err := Merge(c.opt, maps...)
+		if err != nil {
+			t.Fatalf("unexpected error obtained; got %v want nil", err)
+		}
+		if m.Len() != 2000 {
+			t.Fatalf("unexpected len obtained; got %d want %d", m.Len(), 2000)
+		}
+		for i, k := range []string{"0", "500", "1000", "1999"} {
+			if val, _ := m.GetString(k); val != c.want[i] {
+				t.Fatalf("unexpected value obtained; got %q want %q", val, c.want[i])
+			}
+		}
+	}
+	mi, err := MergeInt(MergeOptions[int]{Options: Options{InMemory: true, Duplicate: DuplicateKeepLast}}, mapsInt...)
+	if err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if val, _ := mi.GetString(500); mi.Len() != 2000 || val != "1" {
+		t.Fatalf("unexpected value obtained; got %q %d want %q %d", val, mi.Len(), "1", 2000)
+	}
+	var ke *KeyError
+	if _, err = Merge(MergeOptions[[]byte]{Options: Options{InMemory: true}}, maps...); !errors.As(err, &ke) || !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrDuplicateKey)
+	}
+	if string(ke.Key.([]byte)) != "500" {
+		t.Fatalf("unexpected key obtained; got %q want %q", ke.Key, "500")
+	}
+}
+
+//合并时查找源map不会记录源map的统计指标
+func TestMergeMetrics(t *testing.T) {
+	metrics := NewMetrics("mapMergeMetricsForTest")
+	maps := make([]*NoGcStaticMapAny, 2)
+	for i := range maps {
+		maps[i] = NewDefaultWithOptions(Options{InMemory: true})
+		for k := i * 50; k < i*50+100; k++ {
+			maps[i].SetString(strconv.Itoa(k), strconv.Itoa(i))
+		}
+		maps[i].SetFinished()
+		maps[i].SetMetrics(metrics)
+	}
+	m, err := Merge(MergeOptions[[]byte]{Options: Options{InMemory: true}, Combine: func(k, old, new []byte) []byte {
+		return new
+	}}, maps...)
+	if err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if m.Len() != 150 {
+		t.Fatalf("unexpected len obtained; got %d want %d", m.Len(), 150)
+	}
+	if s := metrics.Snapshot(); s.Hits != 0 || s.Misses != 0 {
+		t.Fatalf("unexpected metrics obtained; got %d %d want 0 0", s.Hits, s.Misses)
+	}
+}
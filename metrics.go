@@ -0,0 +1,146 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"expvar"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+//计数器的分片数，为2的幂
+const metricsShards = 32
+
+//查询延迟直方图中各个桶的上限(纳秒)，超过最后一个上限的计入最后一个桶
+var latencyBounds = []uint64{100, 250, 500, 1000, 2500, 5000, 10000, 100000}
+
+//计数器的一个分片 各分片处于不同的缓存行，并发查询时不会相互影响
+type metricsShard struct {
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+	nanos   atomic.Uint64
+	buckets [9]atomic.Uint64 //len(latencyBounds)+1
+	_       [32]byte
+}
+
+//查询的统计指标 记录Get,GetUnsafe,GetDataBeginPosOfKVPair等查询的命中次数，未命中次数以及延迟
+//用SetMetrics设置到map上后生效，没有设置时查询只多一次nil判断
+type Metrics struct {
+	name   string
+	shards [metricsShards]metricsShard
+}
+
+//初始化 name用于expvar以及MetricsCollector中区分不同的map
+func NewMetrics(name string) *Metrics {
+	return &Metrics{name: name}
+}
+
+//返回初始化时的名称
+func (m *Metrics) Name() string {
+	return m.name
+}
+
+//查询开始
+func (m *Metrics) start() time.Time {
+	return time.Now()
+}
+
+//记录一次查询 随机选择一个分片，避免多个goroutine同时修改同一个计数器
+func (m *Metrics) observe(start time.Time, exist bool) {
+	nanos := uint64(time.Since(start))
+	s := &m.shards[rand.Uint32()&(metricsShards-1)]
+	if exist {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+	s.nanos.Add(nanos)
+	i := 0
+	for i < len(latencyBounds) && nanos > latencyBounds[i] {
+		i = i + 1
+	}
+	s.buckets[i].Add(1)
+}
+
+//某一时刻的统计指标
+type MetricsSnapshot struct {
+	Hits          uint64   //命中次数
+	Misses        uint64   //未命中次数
+	LatencyNanos  uint64   //所有查询的总延迟(纳秒)
+	LatencyBounds []uint64 //延迟直方图中各个桶的上限(纳秒)
+	LatencyCounts []uint64 //落入各个桶的查询次数，比LatencyBounds多一个，最后一个为超过所有上限的次数
+}
+
+//汇总所有分片，返回当前的统计指标
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{LatencyBounds: append([]uint64(nil), latencyBounds...), LatencyCounts: make([]uint64, len(latencyBounds)+1)}
+	for i := range m.shards {
+		shard := &m.shards[i]
+		s.Hits = s.Hits + shard.hits.Load()
+		s.Misses = s.Misses + shard.misses.Load()
+		s.LatencyNanos = s.LatencyNanos + shard.nanos.Load()
+		for j := range s.LatencyCounts {
+			s.LatencyCounts[j] = s.LatencyCounts[j] + shard.buckets[j].Load()
+		}
+	}
+	return s
+}
+
+//以初始化时的名称发布到expvar,同一个名称只能发布一次，否则expvar会panic
+func (m *Metrics) Publish() {
+	expvar.Publish(m.name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+//指标的收集接口，实现此接口即可把指标适配到Prometheus等监控系统
+type MetricsCollector interface {
+	//计数器 name为hits或者misses
+	Counter(mapName, name string, value uint64)
+	//延迟的直方图(纳秒) name为latency,bounds为各个桶的上限,counts为小于等于对应上限的累计次数，
+	//count为总次数，sum为总延迟，与Prometheus的直方图一致
+	Histogram(mapName, name string, bounds []uint64, counts []uint64, count, sum uint64)
+}
+
+//把当前的统计指标交给收集器
+func (m *Metrics) Collect(c MetricsCollector) {
+	s := m.Snapshot()
+	c.Counter(m.name, "hits", s.Hits)
+	c.Counter(m.name, "misses", s.Misses)
+	counts := make([]uint64, len(s.LatencyBounds))
+	var cumulative uint64
+	for i := range counts {
+		cumulative = cumulative + s.LatencyCounts[i]
+		counts[i] = cumulative
+	}
+	c.Histogram(m.name, "latency", s.LatencyBounds, counts, s.Hits+s.Misses, s.LatencyNanos)
+}
+
+//设置查询的统计指标，为nil时不再统计 应在开始查询之前设置，多个map可以共用同一个Metrics
+func (n *NoGcStaticMapAny) SetMetrics(m *Metrics) {
+	n.metrics = m
+}
+
+//设置查询的统计指标 同NoGcStaticMapAny.SetMetrics
+func (n *NoGcStaticMapHuge) SetMetrics(m *Metrics) {
+	n.metrics = m
+}
+
+//设置查询的统计指标 同NoGcStaticMapAny.SetMetrics
+func (n *NoGcStaticMapInt) SetMetrics(m *Metrics) {
+	n.metrics = m
+}
+
+//设置查询的统计指标 同NoGcStaticMapAny.SetMetrics
+func (n *NoGcStaticMapUint32) SetMetrics(m *Metrics) {
+	n.metrics = m
+}
+
+//设置查询的统计指标 同NoGcStaticMapAny.SetMetrics
+func (n *NoGcStaticMap[K, V]) SetMetrics(m *Metrics) {
+	n.m.SetMetrics(m)
+}
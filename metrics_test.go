@@ -0,0 +1,71 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+//记录收集到的指标
+type testCollector struct {
+	counters map[string]uint64
+	count    uint64
+	counts   []uint64
+}
+
+func (c *testCollector) Counter(mapName, name string, value uint64) {
+	c.counters[mapName+"."+name] = value
+}
+
+func (c *testCollector) Histogram(mapName, name string, bounds []uint64, counts []uint64, count, sum uint64) {
+	c.count = count
+	c.counts = counts
+}
+
+//TestMetrics运行的次数
+var metricsTestRuns atomic.Uint64
+
+func TestMetrics(t *testing.T) {
+	m := NewDefaultWithOptions(Options{InMemory: true})
+	mi := NewIntWithOptions(Options{InMemory: true})
+	for i := 0; i < 100; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		mi.SetString(i, strconv.Itoa(i))
+	}
+	m.SetFinished()
+	mi.SetFinished()
+	//没有设置Metrics时不统计
+	m.Get([]byte("1"))
+	//expvar中的名称不能重复，go test -count=n会在同一个进程中多次运行
+	name := "mapMetricsForTest" + strconv.FormatUint(metricsTestRuns.Add(1), 10)
+	metrics := NewMetrics(name)
+	m.SetMetrics(metrics)
+	mi.SetMetrics(metrics)
+	for i := 0; i < 200; i++ {
+		m.Get([]byte(strconv.Itoa(i)))
+		m.GetString(strconv.Itoa(i))
+		mi.GetUnsafe(i)
+		mi.GetDataBeginPosOfKVPair(i)
+	}
+	s := metrics.Snapshot()
+	if s.Hits != 400 || s.Misses != 400 {
+		t.Fatalf("unexpected metrics obtained; got %d %d want %d %d", s.Hits, s.Misses, 400, 400)
+	}
+	c := &testCollector{counters: make(map[string]uint64)}
+	metrics.Collect(c)
+	if c.counters[name+".hits"] != 400 || c.count != 800 || c.counts[len(c.counts)-1] > 800 {
+		t.Fatalf("unexpected metrics obtained; got %v %d %v", c.counters, c.count, c.counts)
+	}
+	metrics.Publish()
+	var published MetricsSnapshot
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil || published.Misses != 400 {
+		t.Fatalf("unexpected expvar obtained; got %+v %v", published, err)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+
+//go:build !unix
+
+package noGcStaticMap
+
+import (
+	"os"
+)
+
+//不支持mmap的平台直接把文件读入内存
+func mmapFile(fileName string) ([]byte, error) {
+	return os.ReadFile(fileName)
+}
+
+//不支持mmap的平台无需解除映射
+func munmapFile(b []byte) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+
+//go:build unix
+
+package noGcStaticMap
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+//把整个文件以只读方式映射到内存
+func mmapFile(fileName string) ([]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size <= 0 {
+		return nil, errors.New("can't mmap empty file " + fileName)
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file is too large to mmap " + fileName)
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+//解除文件映射
+func munmapFile(b []byte) error {
+	return syscall.Munmap(b)
+}
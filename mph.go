@@ -0,0 +1,231 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+//最小完美hash的参数
+const (
+	mphGamma     = 2  //每层位图大小为剩余键个数的倍数，越大构建越快但占用越多
+	mphMaxLevels = 48 //最大层数,超过层数仍未放置的键(一般是64位hash完全相同的键)放入fallback
+)
+
+//BBHash方式的最小完美hash索引
+//每层一个位图,键在某层的位置上没有和其它键冲突时，把该位置1，冲突的键留到下一层继续放置;
+//键在所有层拼接后的位图中的排名(rank)即为其在poses中的下标，每个键只对应一个位置，只需要一次比较
+//所有层都无法放置的键(64位hash完全相同)按hash排序后放入fallback,查询时二分查找
+type mphIndex struct {
+	levels  []uint64 //每层在位图中的开始位置,最后多存一个总长度
+	words   []uint64 //所有层拼接后的位图
+	ranks   []uint64 //每512位之前的累计1的个数,用于快速计算rank
+	poses   posArray //按rank排列的键值对在data中的开始位置
+	fbKeys  []uint64 //fallback中键的hash值，升序
+	fbPoses posArray //fallback中键对应的位置
+}
+
+//某层中键的位置 对hash值按层重新混合后映射到[0,size)
+func mphPos(h uint64, level int, size uint64) uint64 {
+	x := h + uint64(level+1)*0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	x = x ^ (x >> 31)
+	hi, _ := bits.Mul64(x, size)
+	return hi
+}
+
+//根据键的hash值以及对应的位置构建最小完美hash
+func newMphIndex(hashes []uint64, poses []uint64, offset64 bool) mphIndex {
+	var x mphIndex
+	remaining := make([]uint32, len(hashes))
+	for i := range remaining {
+		remaining[i] = uint32(i)
+	}
+	for level := 0; len(remaining) > 0 && level < mphMaxLevels; level++ {
+		size := (uint64(len(remaining))*mphGamma + 63) / 64 * 64
+		seen := make([]uint64, size/64)
+		collide := make([]uint64, size/64)
+		for _, i := range remaining {
+			p := mphPos(hashes[i], level, size)
+			if seen[p/64]&(1<<(p%64)) != 0 {
+				collide[p/64] |= 1 << (p % 64)
+			} else {
+				seen[p/64] |= 1 << (p % 64)
+			}
+		}
+		//只保留没有冲突的位置，冲突的键留到下一层
+		next := remaining[:0]
+		for _, i := range remaining {
+			p := mphPos(hashes[i], level, size)
+			if collide[p/64]&(1<<(p%64)) != 0 {
+				next = append(next, i)
+			}
+		}
+		for i := range seen {
+			seen[i] = seen[i] &^ collide[i]
+		}
+		x.levels = append(x.levels, uint64(len(x.words))*64)
+		x.words = append(x.words, seen...)
+		remaining = next
+	}
+	x.levels = append(x.levels, uint64(len(x.words))*64)
+	x.poses = newPosArray(int(x.buildRanks()), offset64)
+	for i, h := range hashes {
+		if r, ok := x.rankOf(h); ok {
+			x.poses.set(int(r), poses[i])
+		}
+	}
+	//剩下的键放入fallback
+	sort.Slice(remaining, func(a, b int) bool { return hashes[remaining[a]] < hashes[remaining[b]] })
+	x.fbKeys = make([]uint64, len(remaining))
+	x.fbPoses = newPosArray(len(remaining), offset64)
+	for j, i := range remaining {
+		x.fbKeys[j] = hashes[i]
+		x.fbPoses.set(j, poses[i])
+	}
+	return x
+}
+
+//计算每512位之前的累计1的个数,返回1的总数
+func (x *mphIndex) buildRanks() uint64 {
+	x.ranks = make([]uint64, len(x.words)/8+1)
+	var total uint64
+	for i := range x.words {
+		if i%8 == 0 {
+			x.ranks[i/8] = total
+		}
+		total = total + uint64(bits.OnesCount64(x.words[i]))
+	}
+	return total
+}
+
+//计算hash值在位图中的排名，不存在于任何一层时返回false
+func (x *mphIndex) rankOf(h uint64) (uint64, bool) {
+	for level := 0; level < len(x.levels)-1; level++ {
+		begin := x.levels[level]
+		p := begin + mphPos(h, level, x.levels[level+1]-begin)
+		w := x.words[p/64]
+		if w&(1<<(p%64)) == 0 {
+			continue
+		}
+		r := x.ranks[p/512]
+		for i := p / 512 * 8; i < p/64; i++ {
+			r = r + uint64(bits.OnesCount64(x.words[i]))
+		}
+		return r + uint64(bits.OnesCount64(w&(1<<(p%64)-1))), true
+	}
+	return 0, false
+}
+
+//查找键,match用于确认data中的键是否真的相同
+func (x *mphIndex) find(h uint64, match func(dataBeginPos int) bool) (int, bool) {
+	if r, ok := x.rankOf(h); ok {
+		dataBeginPos := int(x.poses.get(int(r)))
+		return dataBeginPos, match(dataBeginPos)
+	}
+	//所有层都不存在，再从fallback中查找
+	i := sort.Search(len(x.fbKeys), func(i int) bool { return x.fbKeys[i] >= h })
+	for ; i < len(x.fbKeys) && x.fbKeys[i] == h; i++ {
+		if dataBeginPos := int(x.fbPoses.get(i)); match(dataBeginPos) {
+			return dataBeginPos, true
+		}
+	}
+	return 0, false
+}
+
+//索引中键的个数
+func (x *mphIndex) count() int {
+	return x.poses.len() + len(x.fbKeys)
+}
+
+//hash值与之前的某个键相同的键的个数 这些键都在fallback中，fallback按hash值排序
+func (x *mphIndex) collisions() int {
+	c := 0
+	for i := 1; i < len(x.fbKeys); i++ {
+		if x.fbKeys[i] == x.fbKeys[i-1] {
+			c = c + 1
+		}
+	}
+	return c
+}
+
+//索引占用的内存字节数
+func (x *mphIndex) size() int {
+	return len(x.levels)*8 + len(x.words)*8 + len(x.ranks)*8 + x.poses.size() + len(x.fbKeys)*8 + x.fbPoses.size()
+}
+
+//把索引写入快照 依次为层数,位图长度,键个数,fallback个数(各8字节),之后为各部分内容，rank读取时重新计算
+func (x *mphIndex) writeTo(w *bufio.Writer) error {
+	var buf [8]byte
+	for _, v := range []int{len(x.levels), len(x.words), x.poses.len(), len(x.fbKeys)} {
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	for _, s := range [][]uint64{x.levels, x.words, x.fbKeys} {
+		for _, v := range s {
+			binary.LittleEndian.PutUint64(buf[:], v)
+			if _, err := w.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := x.poses.writeTo(w); err != nil {
+		return err
+	}
+	return x.fbPoses.writeTo(w)
+}
+
+//从快照中读取writeTo写入的索引 alias为true时直接引用b,见readUint64s,rank在堆上重新计算
+func readMphIndex(b []byte, offset64 bool, alias bool) (x mphIndex, err error) {
+	if len(b) < 32 {
+		return x, io.ErrUnexpectedEOF
+	}
+	var counts [4]uint64
+	for i := range counts {
+		counts[i] = binary.LittleEndian.Uint64(b[i*8:])
+		if counts[i] > uint64(len(b)) {
+			return x, io.ErrUnexpectedEOF
+		}
+	}
+	b = b[32:]
+	if uint64(len(b))/8 < counts[0]+counts[1]+counts[3] {
+		return x, io.ErrUnexpectedEOF
+	}
+	read64 := func(n uint64) []uint64 {
+		s := readUint64s(b, int(n), alias)
+		b = b[n*8:]
+		return s
+	}
+	x.levels = read64(counts[0])
+	x.words = read64(counts[1])
+	x.fbKeys = read64(counts[3])
+	if x.poses, b, err = readPosArray(b, counts[2], offset64, alias); err != nil {
+		return x, err
+	}
+	if x.fbPoses, _, err = readPosArray(b, counts[3], offset64, alias); err != nil {
+		return x, err
+	}
+	if len(x.levels) == 0 || x.levels[0] != 0 || x.levels[len(x.levels)-1] != uint64(len(x.words))*64 {
+		return x, errors.New("invalid minimal perfect hash index in snapshot")
+	}
+	for i := 1; i < len(x.levels); i++ {
+		if x.levels[i] <= x.levels[i-1] {
+			return x, errors.New("invalid minimal perfect hash index in snapshot")
+		}
+	}
+	if x.buildRanks() != uint64(x.poses.len()) {
+		return x, errors.New("invalid minimal perfect hash index in snapshot")
+	}
+	return x, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestMinimalPerfectHash(t *testing.T) {
+	m := NewDefaultWithOptions(Options{TempFileName: "mapAnyMphForTest", Index: IndexMinimalPerfectHash})
+	m.SetString("", "empty")
+	for i := 0; i < 100000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	for i := 0; i < 100000; i++ {
+		val, exist := m.GetString(strconv.Itoa(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+	for i := 100000; i < 110000; i++ {
+		if _, exist := m.GetString(strconv.Itoa(i)); exist {
+			t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+		}
+	}
+	if val, _ := m.GetString(""); val != "empty" {
+		t.Fatalf("unexpected value obtained; got %q want %q", val, "empty")
+	}
+	//除去记录位置的4个字节外，每个键占用的空间应该只有几个bit
+	if bitsPerKey := float64(m.perfect.size()-m.perfect.poses.size()) * 8 / float64(m.Len()); bitsPerKey > 8 {
+		t.Fatalf("unexpected bits per key obtained; got %v", bitsPerKey)
+	}
+	//快照
+	fileName := filepath.Join(t.TempDir(), "mph.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDefault(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100000; i++ {
+		val, exist := loaded.GetString(strconv.Itoa(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+}
+
+func TestMinimalPerfectHashFallback(t *testing.T) {
+	//hash值完全相同的键只能放入fallback
+	hashes := []uint64{1, 2, 3, 3, 3}
+	poses := []uint64{10, 20, 30, 40, 50}
+	x := newMphIndex(hashes, poses, false)
+	if len(x.fbKeys) != 3 {
+		t.Fatalf("unexpected fallback size obtained; got %v want %v", len(x.fbKeys), 3)
+	}
+	for i := range hashes {
+		want := int(poses[i])
+		dataBeginPos, exist := x.find(hashes[i], func(dataBeginPos int) bool { return dataBeginPos == want })
+		if !exist || dataBeginPos != want {
+			t.Fatalf("unexpected value obtained; got %v want %v", dataBeginPos, want)
+		}
+	}
+}
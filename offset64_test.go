@@ -0,0 +1,65 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestOffset64(t *testing.T) {
+	for _, index := range []IndexType{IndexOpenAddressing, IndexMinimalPerfectHash} {
+		m := NewDefaultWithOptions(Options{TempFileName: "mapAnyOffset64ForTest", Index: index, Offset64: true})
+		for i := 0; i < 10000; i++ {
+			m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		}
+		m.SetFinished()
+		fileName := filepath.Join(t.TempDir(), "offset64.snapshot")
+		if err := m.SaveToFile(fileName); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadDefault(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10000; i++ {
+			val, exist := loaded.GetString(strconv.Itoa(i))
+			if !exist || val != strconv.Itoa(i) {
+				t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+			}
+			dataBeginPos, _ := loaded.GetDataBeginPosOfKVPair64([]byte(strconv.Itoa(i)))
+			if string(loaded.GetValFromDataBeginPosOfKVPairUnSafe(int(dataBeginPos))) != strconv.Itoa(i) {
+				t.Fatalf("unexpected value obtained at %v", dataBeginPos)
+			}
+		}
+	}
+	mi := NewIntWithOptions(Options{TempFileName: "mapIntOffset64ForTest", Offset64: true})
+	for i := 0; i < 10000; i++ {
+		mi.SetString(i, strconv.Itoa(i))
+	}
+	mi.SetFinished()
+	for i := 0; i < 10000; i++ {
+		val, exist := mi.GetString(i)
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+}
+
+func TestOffsetOverflow(t *testing.T) {
+	m := NewDefault("mapAnyOverflowForTest")
+	defer m.SetFinished()
+	//模拟data已经写满4G的情况
+	m.dataBeginPos = math.MaxUint32
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic when data is larger than 4GB")
+		}
+	}()
+	m.SetString("k", "v")
+}
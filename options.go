@@ -0,0 +1,62 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import "io"
+
+//SetFinished后使用的索引类型
+type IndexType uint32
+
+const (
+	//开放寻址hash表,默认值
+	IndexOpenAddressing IndexType = iota
+	//最小完美hash,键的集合固定后构建,索引本身每个键只占用几个bit,另外每个键需要4个字节记录位置,
+	//查询时只需一次探测加一次键的比较。仅对默认类型以及Huge类型有效，整型类型的索引中直接存储键本身，不使用此类型
+	IndexMinimalPerfectHash
+)
+
+//Set时遇到重复的键的处理方式
+type DuplicatePolicy uint32
+
+const (
+	//返回ErrDuplicateKey,Set会因此panic,默认值
+	DuplicateError DuplicatePolicy = iota
+	//保留第一次Set的值，忽略之后的值
+	DuplicateKeepFirst
+	//保留最后一次Set的值,之前的值仍然占用data中的空间，但不会再被查询到
+	DuplicateKeepLast
+)
+
+//处理重复的键 返回是否跳过本次Set,DuplicateError时同时返回错误
+func (p DuplicatePolicy) handle(k interface{}) (skip bool, err error) {
+	switch p {
+	case DuplicateKeepFirst:
+		return true, nil
+	case DuplicateKeepLast:
+		return false, nil
+	}
+	return true, newKeyError(k, ErrDuplicateKey)
+}
+
+//初始化参数
+type Options struct {
+	TempFileName string             //临时文件名的前缀,实际的文件名中会加上进程号及随机数,为空时使用noGcStaticMap
+	TempDir      string             //临时文件所在的目录,为空时使用os.TempDir()
+	InMemory     bool               //在内存中构建，不使用临时文件，适用于只读的容器等无法写硬盘的场景
+	Storage      io.ReadWriteSeeker //构建期间使用调用方提供的存储，不使用临时文件,优先于InMemory
+	Index        IndexType          //SetFinished后使用的索引类型
+	Offset64     bool               //是否允许data超过4G,开启后索引中每个位置占8个字节,否则data超过4G时Set会panic
+	Duplicate    DuplicatePolicy    //Set时遇到重复的键的处理方式
+}
+
+//兼容原来的初始化方式，只能传入临时文件名
+func optionsFromTempFileName(tempFileName []string) Options {
+	var opt Options
+	if len(tempFileName) > 0 {
+		opt.TempFileName = tempFileName[0]
+	}
+	return opt
+}
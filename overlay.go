@@ -0,0 +1,220 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"sync"
+)
+
+//覆盖层中的值 deleted为true时表示该键已被删除(墓碑)
+type overlayValue struct {
+	v       []byte
+	deleted bool
+}
+
+//在已完成存储的NoGcStaticMapAny之上叠加一个可以修改的普通map,适用于大部分数据不变，只有少量增删改的场景
+//Set,Delete写入覆盖层，Get先查覆盖层，再查静态的base,Compact把覆盖层合并为新的base
+//覆盖层是普通的map,修改的数量很大时会有GC的问题，应定期调用Compact
+//所有方法都是并发安全的
+type NoGcStaticMapOverlay struct {
+	mu        sync.RWMutex
+	compactMu sync.Mutex //保证同一时间只有一个Compact
+	base      *NoGcStaticMapAny
+	frozen    map[string]overlayValue //Compact期间冻结的覆盖层，正在被合并到新的base中
+	overlay   map[string]overlayValue
+	len       int     //可见的键值对个数
+	opt       Options //Compact时构建新的base使用的初始化参数
+}
+
+//初始化 base必须已经完成存储，之后由NoGcStaticMapOverlay负责Close,opt为Compact时构建新的base使用的初始化参数
+func NewOverlay(base *NoGcStaticMapAny, opt Options) *NoGcStaticMapOverlay {
+	if !base.setFinished {
+		panic(ErrNotFinished)
+	}
+	return &NoGcStaticMapOverlay{base: base, overlay: make(map[string]overlayValue), len: base.Len(), opt: opt}
+}
+
+//取出数据
+func (n *NoGcStaticMapOverlay) Get(k []byte) (v []byte, exist bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.get(k)
+}
+
+//依次查询覆盖层，冻结的覆盖层及base,调用方需要持有读锁
+func (n *NoGcStaticMapOverlay) get(k []byte) (v []byte, exist bool) {
+	if o, ok := n.lookup(k); ok {
+		return o.get()
+	}
+	return n.base.Get(k)
+}
+
+//查询覆盖层以及冻结的覆盖层,调用方需要持有读锁
+func (n *NoGcStaticMapOverlay) lookup(k []byte) (overlayValue, bool) {
+	if o, ok := n.overlay[string(k)]; ok {
+		return o, true
+	}
+	o, ok := n.frozen[string(k)]
+	return o, ok
+}
+
+//取出数据并追加到dst之后返回，复用dst可以避免每次分配内存，键不存在时原样返回dst
+func (n *NoGcStaticMapOverlay) AppendValue(dst []byte, k []byte) ([]byte, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if o, ok := n.lookup(k); ok {
+		if o.deleted {
+			return dst, false
+		}
+		return append(dst, o.v...), true
+	}
+	return n.base.AppendValue(dst, k)
+}
+
+//复制覆盖层中的值
+func (o overlayValue) get() (v []byte, exist bool) {
+	if o.deleted {
+		return nil, false
+	}
+	if len(o.v) == 0 {
+		return nil, true
+	}
+	return append([]byte(nil), o.v...), true
+}
+
+//取出数据,以string的方式
+func (n *NoGcStaticMapOverlay) GetString(k string) (v string, exist bool) {
+	val, exist := n.Get([]byte(k))
+	return string(val), exist
+}
+
+//增加或者修改数据 键值的最大长度为65535
+func (n *NoGcStaticMapOverlay) Set(k, v []byte) {
+	if err := n.TrySet(k, v); err != nil {
+		panic(err)
+	}
+}
+
+//增加或者修改数据,出错时返回*KeyError而不是panic
+func (n *NoGcStaticMapOverlay) TrySet(k, v []byte) error {
+	//Compact时需要写入NoGcStaticMapAny,长度限制与其一致
+	if len(k) > 65535 || len(v) > 65535 {
+		return newKeyError(k, ErrValueTooLarge)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, exist := n.get(k); !exist {
+		n.len = n.len + 1
+	}
+	n.overlay[string(k)] = overlayValue{v: append([]byte(nil), v...)}
+	return nil
+}
+
+//增加或者修改数据,以string的方式
+func (n *NoGcStaticMapOverlay) SetString(k, v string) {
+	n.Set([]byte(k), []byte(v))
+}
+
+//删除数据 在覆盖层中记录墓碑，Compact时才从base中真正删除
+func (n *NoGcStaticMapOverlay) Delete(k []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, exist := n.get(k); !exist {
+		return
+	}
+	n.len = n.len - 1
+	n.overlay[string(k)] = overlayValue{deleted: true}
+}
+
+//删除数据,以string的方式
+func (n *NoGcStaticMapOverlay) DeleteString(k string) {
+	n.Delete([]byte(k))
+}
+
+//返回键值对个数
+func (n *NoGcStaticMapOverlay) Len() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.len
+}
+
+//返回覆盖层中尚未合并到base的修改个数，可以据此决定何时Compact
+func (n *NoGcStaticMapOverlay) OverlayLen() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.overlay) + len(n.frozen)
+}
+
+//把覆盖层合并为新的静态base,旧的base会被Close
+//合并期间覆盖层被冻结，Get,Set,Delete可以照常进行，之后的修改写入新的覆盖层
+func (n *NoGcStaticMapOverlay) Compact() error {
+	n.compactMu.Lock()
+	defer n.compactMu.Unlock()
+	n.mu.Lock()
+	n.frozen = n.overlay
+	n.overlay = make(map[string]overlayValue)
+	base, frozen := n.base, n.frozen
+	n.mu.Unlock()
+	//base及frozen在合并期间不会被修改，不需要加锁
+	m, err := compactOverlay(base, frozen, n.opt)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		//合并失败时把冻结的覆盖层放回去,新的覆盖层中的修改更新
+		for k, o := range n.overlay {
+			frozen[k] = o
+		}
+		n.overlay = frozen
+		n.frozen = nil
+		return err
+	}
+	n.base = m
+	n.frozen = nil
+	//持有写锁时没有正在进行的读取，可以直接Close
+	return base.Close()
+}
+
+//把base中未被覆盖的键值对以及覆盖层中的键值对写入新的map
+func compactOverlay(base *NoGcStaticMapAny, overlay map[string]overlayValue, opt Options) (*NoGcStaticMapAny, error) {
+	opt.Duplicate = DuplicateError
+	m, err := TryNewDefaultWithOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	base.Range(func(k, v []byte) bool {
+		if _, ok := overlay[string(k)]; ok {
+			return true
+		}
+		err = m.TrySet(k, v)
+		return err == nil
+	})
+	if err != nil {
+		m.Abort()
+		return nil, err
+	}
+	for k, o := range overlay {
+		if o.deleted {
+			continue
+		}
+		if err = m.TrySet([]byte(k), o.v); err != nil {
+			m.Abort()
+			return nil, err
+		}
+	}
+	if err = m.Finish(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//释放base占用的数据，之后不能再使用
+func (n *NoGcStaticMapOverlay) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.overlay = nil
+	n.frozen = nil
+	return n.base.Close()
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	base := NewDefaultWithOptions(Options{InMemory: true})
+	for i := 0; i < 1000; i++ {
+		base.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	base.SetFinished()
+	m := NewOverlay(base, Options{InMemory: true})
+	defer m.Close()
+	m.SetString("1", "one")
+	m.SetString("1000", "1000")
+	m.DeleteString("2")
+	m.DeleteString("2")
+	m.DeleteString("not exist")
+	check := func() {
+		if m.Len() != 1000 {
+			t.Fatalf("unexpected len obtained; got %d want %d", m.Len(), 1000)
+		}
+		if val, _ := m.GetString("1"); val != "one" {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, "one")
+		}
+		if val, _ := m.GetString("1000"); val != "1000" {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, "1000")
+		}
+		if val, exist := m.GetString("2"); exist {
+			t.Fatalf("unexpected value obtained; got %q want nothing", val)
+		}
+		if val, _ := m.GetString("3"); val != "3" {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, "3")
+		}
+	}
+	check()
+	if m.OverlayLen() != 3 {
+		t.Fatalf("unexpected overlay len obtained; got %d want %d", m.OverlayLen(), 3)
+	}
+	if err := m.Compact(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	check()
+	if m.OverlayLen() != 0 || m.base.Len() != 1000 {
+		t.Fatalf("unexpected len obtained; got %d %d want %d %d", m.OverlayLen(), m.base.Len(), 0, 1000)
+	}
+	//合并后的base中删除过的键可以再次增加
+	m.SetString("2", "two")
+	if val, _ := m.GetString("2"); val != "two" || m.Len() != 1001 {
+		t.Fatalf("unexpected value obtained; got %q %d want %q %d", val, m.Len(), "two", 1001)
+	}
+}
+
+//Set与NoGcStaticMapAny.Set一样以*KeyError作为panic的值
+func TestOverlaySetPanicValue(t *testing.T) {
+	base := NewDefaultWithOptions(Options{InMemory: true})
+	base.SetFinished()
+	o := NewOverlay(base, Options{InMemory: true})
+	defer func() {
+		if _, ok := recover().(*KeyError); !ok {
+			t.Fatalf("expected *KeyError as panic value")
+		}
+	}()
+	o.Set(make([]byte, 65536), nil)
+}
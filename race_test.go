@@ -0,0 +1,12 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+
+//go:build race
+
+package noGcStaticMap
+
+//race检测器会引入额外的内存分配,此时跳过精确的分配次数检查
+const raceEnabled = true
@@ -0,0 +1,79 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	m := NewDefaultWithOptions(Options{TempFileName: "mapAnyRangeForTest", Duplicate: DuplicateKeepLast})
+	mh := NewHuge("mapHugeRangeForTest")
+	mi := NewInt("mapIntRangeForTest")
+	mu := NewUint32("mapUint32RangeForTest")
+	for i := 0; i < 10000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		mh.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		mi.SetString(-i, strconv.Itoa(i))
+		mu.SetString(uint32(i), strconv.Itoa(i))
+	}
+	//被覆盖的键值对不应该被遍历到
+	m.SetString("0", "new")
+	m.SetFinished()
+	mh.SetFinished()
+	mi.SetFinished()
+	mu.SetFinished()
+	var count int
+	m.Range(func(k, v []byte) bool {
+		count++
+		if string(k) == "0" {
+			if string(v) != "new" {
+				t.Fatalf("unexpected value obtained; got %q want %q", v, "new")
+			}
+		} else if string(k) != string(v) {
+			t.Fatalf("unexpected value obtained; got %q want %q", v, k)
+		}
+		return true
+	})
+	if count != 10000 {
+		t.Fatalf("unexpected count obtained; got %v want %v", count, 10000)
+	}
+	count = 0
+	mh.Range(func(k, v []byte) bool {
+		count++
+		if string(k) != string(v) {
+			t.Fatalf("unexpected value obtained; got %q want %q", v, k)
+		}
+		return true
+	})
+	if count != 10000 {
+		t.Fatalf("unexpected count obtained; got %v want %v", count, 10000)
+	}
+	count = 0
+	mi.Range(func(k int, v []byte) bool {
+		count++
+		if strconv.Itoa(-k) != string(v) {
+			t.Fatalf("unexpected value obtained; got %q want %q", v, strconv.Itoa(-k))
+		}
+		return true
+	})
+	if count != 10000 {
+		t.Fatalf("unexpected count obtained; got %v want %v", count, 10000)
+	}
+	//提前结束遍历
+	count = 0
+	mu.Range(func(k uint32, v []byte) bool {
+		count++
+		if strconv.Itoa(int(k)) != string(v) {
+			t.Fatalf("unexpected value obtained; got %q want %q", v, strconv.Itoa(int(k)))
+		}
+		return count < 10
+	})
+	if count != 10 {
+		t.Fatalf("unexpected count obtained; got %v want %v", count, 10)
+	}
+}
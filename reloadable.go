@@ -0,0 +1,128 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var errReloadableClosed = errors.New("can't use Reloadable after Close")
+
+//Reloadable可以包装的map,所有的map类型都满足此接口
+//默认类型及Huge类型为StaticMap[[]byte, []byte],NoGcStaticMapInt为StaticMap[int, []byte],NoGcStaticMapUint32为StaticMap[uint32, []byte]
+type StaticMap[K, V any] interface {
+	Get(k K) (V, bool)
+	Close() error
+}
+
+//Reloadable中的一代map
+type generation[M io.Closer] struct {
+	m    M
+	refs atomic.Int64 //Reloadable本身持有1个引用，每个正在进行的读取各持有1个引用，减到0时Close
+}
+
+//增加引用 已经被释放时返回false
+func (g *generation[M]) acquire() bool {
+	for refs := g.refs.Load(); refs > 0; refs = g.refs.Load() {
+		if g.refs.CompareAndSwap(refs, refs+1) {
+			return true
+		}
+	}
+	return false
+}
+
+//减少引用 最后一个引用释放时Close,释放内存或者解除文件映射
+func (g *generation[M]) release() error {
+	if g.refs.Add(-1) == 0 {
+		return g.m.Close()
+	}
+	return nil
+}
+
+//可以热替换的map 定期在后台用loader重新构建或者加载新的一代map,原子地替换当前的map,
+//旧的map在所有正在进行的读取结束后才会Close,因此Get不需要加锁，也不会读到已经释放的数据
+type Reloadable[K, V any, M StaticMap[K, V]] struct {
+	cur    atomic.Pointer[generation[M]]
+	loader func() (M, error)
+	mu     sync.Mutex //保证Reload,Close依次进行
+}
+
+//初始化 立即调用loader加载第一代map,loader返回的map必须已经完成存储(SetFinished)
+//例如: NewReloadable[[]byte, []byte](func() (*NoGcStaticMapAny, error) { return LoadDefaultMmap(fileName) })
+func NewReloadable[K, V any, M StaticMap[K, V]](loader func() (M, error)) (*Reloadable[K, V, M], error) {
+	m, err := loader()
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloadable[K, V, M]{loader: loader}
+	r.cur.Store(newGeneration(m))
+	return r, nil
+}
+
+func newGeneration[M io.Closer](m M) *generation[M] {
+	g := &generation[M]{m: m}
+	g.refs.Store(1)
+	return g
+}
+
+//取得当前的一代map并增加引用，用完后需要release
+func (r *Reloadable[K, V, M]) acquire() *generation[M] {
+	for {
+		g := r.cur.Load()
+		if g == nil {
+			panic(errReloadableClosed)
+		}
+		//增加引用失败说明这一代刚刚被替换并释放，重新读取新的一代
+		if g.acquire() {
+			return g
+		}
+	}
+}
+
+//从当前的一代map中取出数据
+func (r *Reloadable[K, V, M]) Get(k K) (v V, exist bool) {
+	g := r.acquire()
+	v, exist = g.m.Get(k)
+	g.release()
+	return v, exist
+}
+
+//在fn返回之前，当前的一代map不会被Close,可以在fn中使用GetUnsafe等返回内部引用的函数，但这些引用不能在fn返回后继续使用
+func (r *Reloadable[K, V, M]) View(fn func(m M)) {
+	g := r.acquire()
+	defer g.release()
+	fn(g.m)
+}
+
+//调用loader构建新的一代map并原子地替换当前的map,旧的map在正在进行的读取结束后Close
+//loader出错时返回错误，继续使用当前的map
+func (r *Reloadable[K, V, M]) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cur.Load() == nil {
+		return errReloadableClosed
+	}
+	m, err := r.loader()
+	if err != nil {
+		return err
+	}
+	old := r.cur.Swap(newGeneration(m))
+	return old.release()
+}
+
+//释放当前的一代map,之后不能再使用
+func (r *Reloadable[K, V, M]) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.cur.Swap(nil)
+	if old == nil {
+		return nil
+	}
+	return old.release()
+}
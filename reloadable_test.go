@@ -0,0 +1,88 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var (
+	_ StaticMap[[]byte, []byte] = (*NoGcStaticMapAny)(nil)
+	_ StaticMap[[]byte, []byte] = (*NoGcStaticMapHuge)(nil)
+	_ StaticMap[int, []byte]    = (*NoGcStaticMapInt)(nil)
+	_ StaticMap[uint32, []byte] = (*NoGcStaticMapUint32)(nil)
+	_ StaticMap[string, int64]  = (*NoGcStaticMap[string, int64])(nil)
+)
+
+func TestReloadable(t *testing.T) {
+	generation := 0
+	loader := func() (*NoGcStaticMapInt, error) {
+		if generation == 3 {
+			return nil, errors.New("load failed")
+		}
+		generation++
+		m := NewIntWithOptions(Options{InMemory: true})
+		for i := 0; i < 1000; i++ {
+			m.SetString(i, strconv.Itoa(generation))
+		}
+		return m, m.Finish()
+	}
+	r, err := NewReloadable[int, []byte](loader)
+	if err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	var old *NoGcStaticMapInt
+	r.View(func(m *NoGcStaticMapInt) {
+		old = m
+		//正在读取时替换，旧的map仍然可以使用
+		if err := r.Reload(); err != nil {
+			t.Fatalf("unexpected error obtained; got %v want nil", err)
+		}
+		if val, _ := m.GetString(1); val != "1" {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, "1")
+		}
+	})
+	if old.data != nil {
+		t.Fatalf("old generation is not closed after readers finished")
+	}
+	if val, _ := r.Get(1); string(val) != "2" {
+		t.Fatalf("unexpected value obtained; got %q want %q", val, "2")
+	}
+	//并发读取的同时替换
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				if val, exist := r.Get(i % 1000); !exist || (string(val) != "2" && string(val) != "3") {
+					t.Errorf("unexpected value obtained; got %q want 2 or 3", val)
+					return
+				}
+			}
+		}()
+	}
+	if err = r.Reload(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	wg.Wait()
+	//loader出错时继续使用当前的map
+	if err = r.Reload(); err == nil {
+		t.Fatalf("expecting error from failed loader")
+	}
+	if val, _ := r.Get(1); string(val) != "3" {
+		t.Fatalf("unexpected value obtained; got %q want %q", val, "3")
+	}
+	if err = r.Close(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if err = r.Reload(); err == nil {
+		t.Fatalf("expecting error after Close")
+	}
+}
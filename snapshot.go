@@ -0,0 +1,258 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/cespare/xxhash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//快照文件格式:
+//文件头 魔数(4字节) 版本号(4字节) 类型(4字节) 索引类型(2字节) 标志位(2字节) 键值对个数(8字节) data长度(8字节)
+//被覆盖的键值对个数(8字节) data的校验和(8字节,xxhash,标志位中有snapshotFlagChecksum时有效)
+//键和值的编码方式(8字节,只用于泛型的map,为两者类型名的hash值)
+//之后为data的原始内容，补齐到8字节对齐后为静态索引，mmap时索引可以直接引用映射的内容
+const (
+	snapshotMagic      = "NGSM"
+	snapshotVersion    = 1
+	snapshotHeaderSize = 56
+)
+
+//快照中记录的map类型，加载时必须与目标类型一致
+const (
+	kindAny     uint32 = 1
+	kindHuge    uint32 = 2
+	kindInt     uint32 = 3
+	kindUint32  uint32 = 4
+	kindGeneric uint32 = 5 //泛型的map,data与Huge类型相同
+)
+
+//快照标志位
+const (
+	snapshotFlagOffset64 uint16 = 1 << iota //索引中每个位置占8个字节
+	snapshotFlagChecksum                    //文件头中记录了data的校验和
+)
+
+var errNotFinishedForSave = errors.New("can't save before SetFinished")
+
+//快照文件头
+type snapshotHeader struct {
+	kind        uint32
+	index       IndexType
+	offset64    bool
+	len         int
+	dataLen     int
+	dead        int
+	checksum    uint64 //data的校验和,hasChecksum为true时有效
+	hasChecksum bool   //快照中是否记录了data的校验和
+	tag         uint64 //键和值的编码方式，只用于泛型的map
+}
+
+//把快照写入文件 先写入同目录下的临时文件，写完后再改名，避免中途出错时留下不完整的快照
+//临时文件名由os.CreateTemp保证唯一，同时保存到同一个文件时不会相互覆盖临时文件
+func saveSnapshot(fileName string, h snapshotHeader, data []byte, writeIndex func(w *bufio.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	//os.CreateTemp创建的文件只有当前用户可以读写，快照通常需要被其它进程读取
+	if err = f.Chmod(0644); err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	var head [snapshotHeaderSize]byte
+	copy(head[0:4], snapshotMagic)
+	binary.LittleEndian.PutUint32(head[4:8], snapshotVersion)
+	binary.LittleEndian.PutUint32(head[8:12], h.kind)
+	binary.LittleEndian.PutUint16(head[12:14], uint16(h.index))
+	flags := snapshotFlagChecksum
+	if h.offset64 {
+		flags = flags | snapshotFlagOffset64
+	}
+	binary.LittleEndian.PutUint16(head[14:16], flags)
+	binary.LittleEndian.PutUint64(head[16:24], uint64(h.len))
+	binary.LittleEndian.PutUint64(head[24:32], uint64(len(data)))
+	binary.LittleEndian.PutUint64(head[32:40], uint64(h.dead))
+	binary.LittleEndian.PutUint64(head[40:48], xxhash.Sum64(data))
+	binary.LittleEndian.PutUint64(head[48:56], h.tag)
+	if _, err = bw.Write(head[:]); err != nil {
+		return err
+	}
+	if _, err = bw.Write(data); err != nil {
+		return err
+	}
+	var pad [8]byte
+	if _, err = bw.Write(pad[:snapshotPadding(len(data))]); err != nil {
+		return err
+	}
+	if err = writeIndex(bw); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+//解析快照文件头 kind为0时不检查map类型
+func parseSnapshotHeader(b []byte, kind uint32) (h snapshotHeader, err error) {
+	if len(b) < snapshotHeaderSize || string(b[0:4]) != snapshotMagic {
+		return h, errors.New("not a NoGcStaticMap snapshot")
+	}
+	if v := binary.LittleEndian.Uint32(b[4:8]); v != snapshotVersion {
+		return h, fmt.Errorf("unsupported snapshot version %d", v)
+	}
+	h.kind = binary.LittleEndian.Uint32(b[8:12])
+	if kind != 0 && h.kind != kind {
+		return h, fmt.Errorf("snapshot kind mismatch, got %d want %d", h.kind, kind)
+	}
+	h.index = IndexType(binary.LittleEndian.Uint16(b[12:14]))
+	flags := binary.LittleEndian.Uint16(b[14:16])
+	h.offset64 = flags&snapshotFlagOffset64 != 0
+	h.hasChecksum = flags&snapshotFlagChecksum != 0
+	if h.index != IndexOpenAddressing && h.index != IndexMinimalPerfectHash {
+		return h, fmt.Errorf("unsupported index type %d", h.index)
+	}
+	h.len = int(binary.LittleEndian.Uint64(b[16:24]))
+	h.dataLen = int(binary.LittleEndian.Uint64(b[24:32]))
+	h.dead = int(binary.LittleEndian.Uint64(b[32:40]))
+	h.checksum = binary.LittleEndian.Uint64(b[40:48])
+	h.tag = binary.LittleEndian.Uint64(b[48:56])
+	//每个键值对至少占4个字节，因此键值对个数不会超过data长度
+	if h.dataLen < 0 || h.len < 0 || h.dead < 0 || h.len > h.dataLen || h.dead > h.dataLen-h.len {
+		return h, fmt.Errorf("%w: invalid snapshot header, len %d, dead %d, data length %d", ErrCorrupted, h.len, h.dead, h.dataLen)
+	}
+	return h, nil
+}
+
+//data之后补齐到8字节对齐的字节数，文件头为56字节，因此索引的开始位置也是8字节对齐的
+func snapshotPadding(dataLen int) int {
+	return (8 - dataLen%8) % 8
+}
+
+//检查快照中记录的键和值的编码方式是否与加载时的一致
+func checkSnapshotTag(h snapshotHeader, tag uint64) error {
+	if h.tag != tag {
+		return fmt.Errorf("snapshot codec mismatch, got %x want %x", h.tag, tag)
+	}
+	return nil
+}
+
+//检查文件中是否有足够的data,避免按损坏的文件头分配内存或者越界
+func checkSnapshotSize(h snapshotHeader, fileSize int64) error {
+	if int64(h.dataLen) > fileSize-snapshotHeaderSize-int64(snapshotPadding(h.dataLen)) {
+		return fmt.Errorf("%w: data length %d exceeds file size %d", ErrCorrupted, h.dataLen, fileSize)
+	}
+	return nil
+}
+
+//读取快照文件，返回文件头，data以及索引部分的原始内容
+func loadSnapshot(fileName string, kind uint32) (h snapshotHeader, data []byte, index []byte, err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return h, nil, nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 1<<20)
+	var head [snapshotHeaderSize]byte
+	if _, err = io.ReadFull(br, head[:]); err != nil {
+		return h, nil, nil, err
+	}
+	if h, err = parseSnapshotHeader(head[:], kind); err != nil {
+		return h, nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return h, nil, nil, err
+	}
+	if err = checkSnapshotSize(h, fi.Size()); err != nil {
+		return h, nil, nil, err
+	}
+	data = make([]byte, h.dataLen)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return h, nil, nil, err
+	}
+	if _, err = br.Discard(snapshotPadding(h.dataLen)); err != nil {
+		return h, nil, nil, err
+	}
+	index, err = io.ReadAll(br)
+	if err != nil {
+		return h, nil, nil, err
+	}
+	return h, data, index, nil
+}
+
+//以mmap的方式打开快照文件，data直接引用映射的内容，mapped为整个映射区域，用于之后解除映射
+func mmapSnapshot(fileName string, kind uint32) (h snapshotHeader, data, index, mapped []byte, err error) {
+	mapped, err = mmapFile(fileName)
+	if err != nil {
+		return h, nil, nil, nil, err
+	}
+	if h, err = parseSnapshotHeader(mapped, kind); err != nil {
+		munmapFile(mapped)
+		return h, nil, nil, nil, err
+	}
+	if err = checkSnapshotSize(h, int64(len(mapped))); err != nil {
+		munmapFile(mapped)
+		return h, nil, nil, nil, err
+	}
+	dataEnd := snapshotHeaderSize + h.dataLen
+	return h, mapped[snapshotHeaderSize:dataEnd:dataEnd], mapped[dataEnd+snapshotPadding(h.dataLen):], mapped, nil
+}
+
+//快照文件头中记录的信息
+type SnapshotInfo struct {
+	Kind     string    //map类型,any,huge,int,uint32,generic分别对应LoadDefault,LoadHuge,LoadInt,LoadUint32,LoadGeneric
+	Index    IndexType //索引类型
+	Offset64 bool      //是否开启了Options.Offset64
+	Len      int       //键值对个数
+	Dead     int       //被DuplicateKeepLast覆盖的键值对个数
+	DataLen  int       //data的字节数
+}
+
+//快照中记录的map类型对应的名称
+var snapshotKindNames = map[uint32]string{kindAny: "any", kindHuge: "huge", kindInt: "int", kindUint32: "uint32", kindGeneric: "generic"}
+
+//只读取快照的文件头，不加载数据，可以用于在加载前判断应该使用哪一个Load函数
+func ReadSnapshotInfo(fileName string) (SnapshotInfo, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer f.Close()
+	var head [snapshotHeaderSize]byte
+	if _, err = io.ReadFull(f, head[:]); err != nil {
+		return SnapshotInfo{}, err
+	}
+	h, err := parseSnapshotHeader(head[:], 0)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	name, ok := snapshotKindNames[h.kind]
+	if !ok {
+		return SnapshotInfo{}, fmt.Errorf("unknown snapshot kind %d", h.kind)
+	}
+	return SnapshotInfo{Kind: name, Index: h.index, Offset64: h.offset64, Len: h.len, Dead: h.dead, DataLen: h.dataLen}, nil
+}
@@ -0,0 +1,377 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func TestSnapshotAny(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "any.snapshot")
+	m := NewDefault("mapAnySnapshotForTest")
+	m.SetString("", "empty")
+	for i := 0; i < 10000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDefault(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != m.Len() {
+		t.Fatalf("unexpected len obtained; got %v want %v", loaded.Len(), m.Len())
+	}
+	for i := 0; i < 10000; i++ {
+		val, exist := loaded.GetString(strconv.Itoa(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+	if val, _ := loaded.GetString(""); val != "empty" {
+		t.Fatalf("unexpected value obtained; got %q want %q", val, "empty")
+	}
+	if _, err := LoadHuge(fileName); err == nil {
+		t.Fatalf("expected kind mismatch error")
+	}
+}
+
+//同时保存到同一个文件时各自使用不同的临时文件，结果为其中一个完整的快照
+func TestSnapshotConcurrentSave(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "any.snapshot")
+	m := NewDefaultWithOptions(Options{InMemory: true})
+	for i := 0; i < 10000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.SaveToFile(fileName)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error obtained; got %v want nil", err)
+		}
+	}
+	loaded, err := LoadDefault(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = loaded.Verify(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("unexpected file count obtained; got %d want %d", len(entries), 1)
+	}
+}
+
+func TestSnapshotHuge(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "huge.snapshot")
+	m := NewHuge("mapHugeSnapshotForTest")
+	for i := 0; i < 10000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadHuge(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		val, exist := loaded.GetString(strconv.Itoa(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+}
+
+func TestSnapshotInt(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "int.snapshot")
+	m := NewInt("mapIntSnapshotForTest")
+	for i := 0; i < 10000; i++ {
+		m.SetString(i, strconv.Itoa(i))
+	}
+	m.SetFinished()
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadInt(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		val, exist := loaded.GetString(i)
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+	if _, exist := loaded.Get(10000); exist {
+		t.Fatalf("unexpected value obtained; got %v want %v", exist, false)
+	}
+}
+
+func TestSnapshotUint32(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "uint32.snapshot")
+	m := NewUint32("mapUint32SnapshotForTest")
+	for i := 0; i < 10000; i++ {
+		m.SetString(uint32(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadUint32(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		val, exist := loaded.GetString(uint32(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+}
+
+func TestSnapshotBadFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "bad.snapshot")
+	if err := os.WriteFile(fileName, []byte("not a snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDefault(fileName); err == nil {
+		t.Fatalf("expected error for bad snapshot file")
+	}
+}
+
+func TestSnapshotMmap(t *testing.T) {
+	dir := t.TempDir()
+	m := NewDefault("mapAnyMmapForTest")
+	mi := NewInt("mapIntMmapForTest")
+	for i := 0; i < 10000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		mi.SetString(i, strconv.Itoa(i))
+	}
+	m.SetFinished()
+	mi.SetFinished()
+	if err := m.SaveToFile(filepath.Join(dir, "any.snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mi.SaveToFile(filepath.Join(dir, "int.snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := LoadDefaultMmap(filepath.Join(dir, "any.snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappedInt, err := LoadIntMmap(filepath.Join(dir, "int.snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		val, exist := mapped.GetString(strconv.Itoa(i))
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+		val, exist = mappedInt.GetString(i)
+		if !exist || val != strconv.Itoa(i) {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+		}
+	}
+	if err := mapped.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mappedInt.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//损坏的文件头中的长度
+func TestSnapshotCorruptedHeader(t *testing.T) {
+	dir := t.TempDir()
+	m := NewDefaultWithOptions(Options{InMemory: true})
+	for i := 0; i < 100; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	fileName := filepath.Join(dir, "any.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		offset int
+		value  uint64
+	}{
+		{24, 1 << 63},   //data长度为负数
+		{24, 1 << 40},   //data长度超过文件大小
+		{16, 1 << 63},   //键值对个数为负数
+		{16, 1 << 40},   //键值对个数超过data长度
+		{32, 1<<64 - 1}, //被覆盖的键值对个数为负数
+	} {
+		corrupted := append([]byte(nil), b...)
+		binary.LittleEndian.PutUint64(corrupted[c.offset:], c.value)
+		corruptedName := filepath.Join(dir, "corrupted.snapshot")
+		if err := os.WriteFile(corruptedName, corrupted, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadDefault(corruptedName); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("unexpected error obtained for header field at %d = %d; got %v want %v", c.offset, c.value, err, ErrCorrupted)
+		}
+	}
+}
+
+//mmap时索引直接引用映射的内容，不复制到堆上
+func TestSnapshotMmapIndexShared(t *testing.T) {
+	dir := t.TempDir()
+	for _, index := range []IndexType{IndexOpenAddressing, IndexMinimalPerfectHash} {
+		m := NewDefaultWithOptions(Options{InMemory: true, Index: index})
+		//data长度不是8的倍数，索引需要补齐对齐
+		for i := 0; i < 1001; i++ {
+			m.SetString(strconv.Itoa(i), "v")
+		}
+		m.SetFinished()
+		fileName := filepath.Join(dir, "any.snapshot")
+		if err := m.SaveToFile(fileName); err != nil {
+			t.Fatal(err)
+		}
+		mapped, err := LoadDefaultMmap(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		begin := uintptr(unsafe.Pointer(&mapped.mapped[0]))
+		end := begin + uintptr(len(mapped.mapped))
+		var p uintptr
+		if index == IndexMinimalPerfectHash {
+			p = uintptr(unsafe.Pointer(&mapped.perfect.words[0]))
+		} else {
+			p = uintptr(unsafe.Pointer(&mapped.table.keys[0]))
+		}
+		if littleEndian && (p < begin || p >= end) {
+			t.Fatalf("index of mmap snapshot is copied to the heap")
+		}
+		if v, exist := mapped.GetString("1000"); !exist || v != "v" {
+			t.Fatalf("unexpected value obtained; got %q want %q", v, "v")
+		}
+		if err := mapped.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, exist := mapped.GetString("1000"); exist {
+			t.Fatalf("unexpected key found after Close")
+		}
+	}
+}
+
+//损坏的文件头中的data长度，mmap时不能越界
+func TestSnapshotMmapCorruptedHeader(t *testing.T) {
+	dir := t.TempDir()
+	m := NewIntWithOptions(Options{InMemory: true})
+	m.SetString(1, "1")
+	m.SetFinished()
+	fileName := filepath.Join(dir, "int.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dataLen := range []uint64{1 << 63, 1 << 40, uint64(len(b))} {
+		binary.LittleEndian.PutUint64(b[24:], dataLen)
+		if err := os.WriteFile(fileName, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadIntMmap(fileName); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("unexpected error obtained for data length %d; got %v want %v", dataLen, err, ErrCorrupted)
+		}
+	}
+}
+
+func TestReadSnapshotInfo(t *testing.T) {
+	m := NewUint32WithOptions(Options{InMemory: true, Offset64: true})
+	m.SetString(1, "1")
+	m.SetString(2, "2")
+	m.SetFinished()
+	fileName := filepath.Join(t.TempDir(), "uint32.snapshot")
+	if err := m.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	info, err := ReadSnapshotInfo(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SnapshotInfo{Kind: "uint32", Offset64: true, Len: 2, DataLen: 14}); info != want {
+		t.Fatalf("unexpected info obtained; got %+v want %+v", info, want)
+	}
+}
+
+//Close之后无论map是如何得到的，查询都只返回不存在
+func TestCloseResetsIndex(t *testing.T) {
+	dir := t.TempDir()
+	for _, index := range []IndexType{IndexOpenAddressing, IndexMinimalPerfectHash} {
+		m := NewDefaultWithOptions(Options{InMemory: true, Index: index})
+		h := NewHugeWithOptions(Options{InMemory: true, Index: index})
+		mi := NewIntWithOptions(Options{InMemory: true})
+		mu := NewUint32WithOptions(Options{InMemory: true})
+		m.SetString("1", "1")
+		h.SetString("1", "1")
+		mi.SetString(1, "1")
+		mu.SetString(1, "1")
+		m.SetFinished()
+		h.SetFinished()
+		mi.SetFinished()
+		mu.SetFinished()
+		fileName := filepath.Join(dir, "any.snapshot")
+		if err := m.SaveToFile(fileName); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadDefault(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []interface{ Close() error }{m, h, mi, mu, loaded} {
+			if err := c.Close(); err != nil {
+				t.Fatalf("unexpected error obtained; got %v want nil", err)
+			}
+		}
+		for _, m := range []*NoGcStaticMapAny{m, loaded} {
+			if _, exist := m.Get([]byte("1")); exist {
+				t.Fatalf("unexpected key found after Close")
+			}
+			if _, exist := m.GetString("1"); exist {
+				t.Fatalf("unexpected key found after Close")
+			}
+		}
+		if _, exist := h.Get([]byte("1")); exist {
+			t.Fatalf("unexpected key found after Close")
+		}
+		if _, exist := mi.Get(1); exist {
+			t.Fatalf("unexpected key found after Close")
+		}
+		if _, exist := mu.Get(1); exist {
+			t.Fatalf("unexpected key found after Close")
+		}
+	}
+}
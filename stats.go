@@ -0,0 +1,98 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+//map的统计信息，用于估算内存占用等
+type Stats struct {
+	Len          int     //键值对个数
+	Dead         int     //被DuplicateKeepLast覆盖的键值对个数
+	DataBytes    int     //data占用的字节数
+	IndexBytes   int     //索引占用的字节数,SetFinished之前为构建期间使用的Go map的估算值
+	Collisions   int     //hash值与之前的某个键相同的键的个数，整型类型中总是为0
+	MaxKeySize   int     //最长的键的字节数
+	MaxValueSize int     //最长的值的字节数
+	AvgKeySize   float64 //键的平均字节数
+	AvgValueSize float64 //值的平均字节数
+}
+
+//估算Go map占用的内存 entrySize为每个元素的键和值的大小，另外每个元素有1字节的控制信息，按平均装载率约70%估算
+func estimateMapBytes(count, entrySize int) int {
+	return count * (entrySize + 1) * 10 / 7
+}
+
+//统计键值对的大小
+func (s *Stats) add(keySize, valueSize, count int) {
+	s.MaxKeySize = max(s.MaxKeySize, keySize)
+	s.MaxValueSize = max(s.MaxValueSize, valueSize)
+	s.AvgKeySize = s.AvgKeySize + (float64(keySize)-s.AvgKeySize)/float64(count)
+	s.AvgValueSize = s.AvgValueSize + (float64(valueSize)-s.AvgValueSize)/float64(count)
+}
+
+//构建期间按分区存放的Go map中元素的总个数
+func countEntries[K comparable](index *[512]map[K]uint64) int {
+	entries := 0
+	for i := range index {
+		entries = entries + len(index[i])
+	}
+	return entries
+}
+
+//统计信息的公共部分 SetFinished之后遍历所有未被覆盖的键值对,统计键和值的大小,keySize返回键的字节数
+func recordStats[K any](s Stats, setFinished bool, data []byte, rangeFn func(fn func(k K, v []byte) bool), keySize func(k K) int) Stats {
+	if !setFinished {
+		return s
+	}
+	s.DataBytes = len(data)
+	count := 0
+	rangeFn(func(k K, v []byte) bool {
+		count = count + 1
+		s.add(keySize(k), len(v), count)
+		return true
+	})
+	return s
+}
+
+//[]byte类型的键的字节数
+func bytesKeySize(k []byte) int {
+	return len(k)
+}
+
+//返回统计信息 SetFinished之后需要遍历所有的键值对,键和值的大小只统计未被覆盖的键值对；SetFinished之前键和值的大小为0
+func (n *NoGcStaticMapAny) Stats() Stats {
+	s := Stats{Len: n.len, Dead: n.dead, DataBytes: n.dataBeginPos}
+	n.hashIndex.stats(&s, n.setFinished)
+	return recordStats(s, n.setFinished, n.data, n.Range, bytesKeySize)
+}
+
+//返回统计信息 同NoGcStaticMapAny.Stats
+func (n *NoGcStaticMapHuge) Stats() Stats {
+	s := Stats{Len: n.len, Dead: n.dead, DataBytes: n.dataBeginPos}
+	n.hashIndex.stats(&s, n.setFinished)
+	return recordStats(s, n.setFinished, n.data, n.Range, bytesKeySize)
+}
+
+//返回统计信息 键的大小固定为8个字节，其它同NoGcStaticMapAny.Stats
+func (n *NoGcStaticMapInt) Stats() Stats {
+	s := Stats{Len: n.len, Dead: n.dead, DataBytes: n.dataBeginPos, IndexBytes: n.table.size()}
+	if !n.setFinished {
+		s.IndexBytes = estimateMapBytes(countEntries(&n.index), 16)
+	}
+	return recordStats(s, n.setFinished, n.data, n.Range, func(int) int { return 8 })
+}
+
+//返回统计信息 键的大小固定为4个字节，其它同NoGcStaticMapAny.Stats
+func (n *NoGcStaticMapUint32) Stats() Stats {
+	s := Stats{Len: n.len, Dead: n.dead, DataBytes: n.dataBeginPos, IndexBytes: n.table.size()}
+	if !n.setFinished {
+		s.IndexBytes = estimateMapBytes(countEntries(&n.index), 12)
+	}
+	return recordStats(s, n.setFinished, n.data, n.Range, func(uint32) int { return 4 })
+}
+
+//返回统计信息,键和值的大小为编码后的大小 同NoGcStaticMapHuge.Stats
+func (n *NoGcStaticMap[K, V]) Stats() Stats {
+	return n.m.Stats()
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	m := NewDefaultWithOptions(Options{InMemory: true})
+	m.SetString("a", "1")
+	m.SetString("bbb", "12345")
+	if s := m.Stats(); s.Len != 2 || s.DataBytes != 4*2+1+1+3+5 || s.IndexBytes == 0 || s.Collisions != 0 {
+		t.Fatalf("unexpected stats obtained; got %+v", s)
+	}
+	m.SetFinished()
+	s := m.Stats()
+	want := Stats{Len: 2, DataBytes: 18, IndexBytes: m.table.size(), MaxKeySize: 3, MaxValueSize: 5, AvgKeySize: 2, AvgValueSize: 3}
+	if s != want {
+		t.Fatalf("unexpected stats obtained; got %+v want %+v", s, want)
+	}
+	mi := NewIntWithOptions(Options{InMemory: true})
+	mi.SetString(1, "12")
+	mi.SetFinished()
+	if s = mi.Stats(); s.Len != 1 || s.MaxKeySize != 8 || s.MaxValueSize != 2 || s.AvgValueSize != 2 {
+		t.Fatalf("unexpected stats obtained; got %+v", s)
+	}
+}
+
+func TestIndexCollisions(t *testing.T) {
+	hashes := []uint64{1, 2, 3, 2, 2}
+	poses := []uint64{0, 10, 20, 30, 40}
+	x := newStaticIndex(len(hashes), false)
+	for i := range hashes {
+		x.insert(hashes[i], poses[i])
+	}
+	if c := x.collisions(); c != 2 {
+		t.Fatalf("unexpected collisions obtained; got %d want %d", c, 2)
+	}
+	mph := newMphIndex(hashes, poses, false)
+	if c := mph.collisions(); c != 2 {
+		t.Fatalf("unexpected collisions obtained; got %d want %d", c, 2)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//临时文件的后缀
+const tempFileSuffix = ".NoGcStaticMap"
+
+//构建期间存放键值对的地方，可以是临时文件,内存或者调用方提供的io.ReadWriteSeeker,SetFinished时整体读入内存
+type buildStorage struct {
+	bw       *bufio.Writer      //临时文件及调用方提供的存储使用的写缓存
+	file     *os.File           //硬盘上的临时文件,不使用临时文件时为nil
+	fileName string             //临时文件名
+	mem      *bytes.Buffer      //Options.InMemory时使用
+	rws      io.ReadWriteSeeker //Options.Storage
+	base     int64              //rws中数据的起始位置
+	size     int64              //已写入的字节数
+}
+
+//按初始化参数创建构建期间的存储
+func newBuildStorage(opt Options) (*buildStorage, error) {
+	var s buildStorage
+	switch {
+	case opt.Storage != nil:
+		base, err := opt.Storage.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		s.rws = opt.Storage
+		s.base = base
+		s.bw = bufio.NewWriterSize(s.rws, 40960)
+	case opt.InMemory:
+		s.mem = new(bytes.Buffer)
+	default:
+		f, err := createTempFile(opt.TempDir, opt.TempFileName)
+		if err != nil {
+			return nil, err
+		}
+		s.fileName = f.Name()
+		s.file = f
+		s.bw = bufio.NewWriterSize(f, 40960)
+	}
+	return &s, nil
+}
+
+//写入数据
+func (s *buildStorage) Write(p []byte) (int, error) {
+	var n int
+	var err error
+	if s.mem != nil {
+		n, err = s.mem.Write(p)
+	} else {
+		n, err = s.bw.Write(p)
+	}
+	s.size = s.size + int64(n)
+	return n, err
+}
+
+//读取已写入的数据中off位置开始的len(p)个字节
+func (s *buildStorage) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > s.size {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if s.mem != nil {
+		return copy(p, s.mem.Bytes()[off:]), nil
+	}
+	if err := s.bw.Flush(); err != nil {
+		return 0, err
+	}
+	if s.file != nil {
+		return s.file.ReadAt(p, off)
+	}
+	if _, err := s.rws.Seek(s.base+off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rws, p)
+	if err != nil {
+		return n, err
+	}
+	//回到末尾，之后继续写入
+	if _, err = s.rws.Seek(s.base+s.size, io.SeekStart); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+//结束写入并返回所有数据，临时文件会被删除，出错时同样会关闭并删除临时文件
+func (s *buildStorage) finish() ([]byte, error) {
+	if s.mem != nil {
+		//bytes.Buffer扩容时容量翻倍，最多会多占用1倍的内存，复制到大小正好的切片中再释放
+		b := s.mem.Bytes()
+		if cap(b) > len(b) {
+			b = append(make([]byte, 0, len(b)), b...)
+		}
+		s.mem = nil
+		return b, nil
+	}
+	if err := s.bw.Flush(); err != nil {
+		s.abort()
+		return nil, err
+	}
+	b := make([]byte, s.size)
+	if s.file != nil {
+		if _, err := s.file.ReadAt(b, 0); err != nil && err != io.EOF {
+			s.abort()
+			return nil, err
+		}
+		if err := s.abort(); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if _, err := s.rws.Seek(s.base, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(s.rws, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+//放弃构建，释放内存中的数据或者删除临时文件，调用方提供的存储不做处理，可以重复调用
+func (s *buildStorage) abort() error {
+	if s.mem != nil {
+		s.mem = nil
+		return nil
+	}
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if rmErr := os.Remove(s.fileName); err == nil {
+		err = rmErr
+	}
+	s.file = nil
+	return err
+}
+
+//删除dir中由已经退出的进程遗留的临时文件，返回被删除的文件名，dir为空时使用os.TempDir()
+//使用了Options.TempDir或者带目录的临时文件名时，需要对相应的目录分别调用
+func CleanupTempFiles(dir string) (removed []string, err error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		pid, ok := tempFilePid(e.Name())
+		if !ok || e.IsDir() || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		fileName := filepath.Join(dir, e.Name())
+		if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, fileName)
+	}
+	return removed, nil
+}
+
+//从createTempFile创建的临时文件名中取出进程号
+func tempFilePid(fileName string) (int, bool) {
+	if !strings.HasSuffix(fileName, tempFileSuffix) {
+		return 0, false
+	}
+	fields := strings.Split(strings.TrimSuffix(fileName, tempFileSuffix), ".")
+	if len(fields) < 3 {
+		return 0, false
+	}
+	if _, err := strconv.ParseUint(fields[len(fields)-1], 10, 64); err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(fields[len(fields)-2])
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
@@ -0,0 +1,200 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	//调用方提供的存储中原有的内容不受影响
+	newStorage := func(name string) *os.File {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("cannot create storage: %s", err)
+		}
+		if _, err = f.WriteString("prefix"); err != nil {
+			t.Fatalf("cannot write storage: %s", err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	for _, opts := range [][2]Options{
+		{{TempDir: dir}, {TempDir: dir}},
+		{{InMemory: true}, {InMemory: true}},
+		{{Storage: newStorage("storage")}, {Storage: newStorage("storageInt")}},
+	} {
+		m := NewDefaultWithOptions(opts[0])
+		mi := NewIntWithOptions(opts[1])
+		for i := 0; i < 10000; i++ {
+			m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		}
+		//重复的键需要读取已写入的内容
+		if err := m.TrySet([]byte("1"), nil); !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrDuplicateKey)
+		}
+		m.SetFinished()
+		for i := 0; i < 10000; i++ {
+			mi.SetString(i, strconv.Itoa(i))
+		}
+		mi.SetFinished()
+		for i := 0; i < 10000; i++ {
+			if val, _ := m.GetString(strconv.Itoa(i)); val != strconv.Itoa(i) {
+				t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+			}
+			if val, _ := mi.GetString(i); val != strconv.Itoa(i) {
+				t.Fatalf("unexpected value obtained; got %q want %q", val, strconv.Itoa(i))
+			}
+		}
+	}
+	for _, name := range []string{"storage", "storageInt"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(b[:6]) != "prefix" {
+			t.Fatalf("unexpected storage content obtained; got %q want prefix", b)
+		}
+	}
+	//临时文件都已删除
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected temp files obtained; got %v want only storage", entries)
+	}
+}
+
+//InMemory时完成后的data不保留bytes.Buffer多余的容量
+func TestInMemoryExactSize(t *testing.T) {
+	m := NewDefaultWithOptions(Options{InMemory: true})
+	for i := 0; i < 10000; i++ {
+		m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	m.SetFinished()
+	if cap(m.data) != len(m.data) {
+		t.Fatalf("unexpected data capacity obtained; got %d want %d", cap(m.data), len(m.data))
+	}
+}
+
+func TestAbort(t *testing.T) {
+	dir := t.TempDir()
+	//同名的文件不会被覆盖
+	if err := os.WriteFile(filepath.Join(dir, "mapAnyAbortForTest.NoGcStaticMap"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+	m := NewDefaultWithOptions(Options{TempDir: dir, TempFileName: "mapAnyAbortForTest"})
+	mi := NewIntWithOptions(Options{TempDir: dir})
+	m.SetString("1", "1")
+	mi.SetString(1, "1")
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Fatalf("unexpected file count obtained; got %d want %d", len(entries), 3)
+	}
+	if err := m.Abort(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if err := mi.Close(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if err := m.TrySet([]byte("2"), nil); !errors.Is(err, ErrAborted) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrAborted)
+	}
+	if err := mi.Finish(); !errors.Is(err, ErrAborted) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrAborted)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "mapAnyAbortForTest.NoGcStaticMap"))
+	if err != nil || string(b) != "keep" {
+		t.Fatalf("unexpected file content obtained; got %q want %q", b, "keep")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("unexpected file count obtained; got %d want %d", len(entries), 1)
+	}
+}
+
+func TestCleanupTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	m := NewDefaultWithOptions(Options{TempDir: dir})
+	defer m.Close()
+	m.SetString("1", "1")
+	//已经退出的进程遗留的文件,以及不是临时文件的文件
+	stale := filepath.Join(dir, "noGcStaticMap.2147483647.123.NoGcStaticMap")
+	for _, fileName := range []string{stale, filepath.Join(dir, "other.NoGcStaticMap"), filepath.Join(dir, "other.txt")} {
+		if err := os.WriteFile(fileName, nil, 0644); err != nil {
+			t.Fatalf("cannot write file: %s", err)
+		}
+	}
+	removed, err := CleanupTempFiles(dir)
+	if err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if len(removed) != 1 || removed[0] != stale {
+		t.Fatalf("unexpected removed files obtained; got %q want %q", removed, stale)
+	}
+	//当前进程正在使用的临时文件不受影响
+	m.SetFinished()
+	if val, _ := m.GetString("1"); val != "1" {
+		t.Fatalf("unexpected value obtained; got %q want %q", val, "1")
+	}
+}
+
+//无法创建临时文件时返回错误而不是panic
+func TestTryNewTempFileError(t *testing.T) {
+	opt := Options{TempDir: filepath.Join(t.TempDir(), "missing")}
+	if _, err := TryNewDefaultWithOptions(opt); err == nil {
+		t.Fatalf("expected error for missing temp dir")
+	}
+	if _, err := TryNewHugeWithOptions(opt); err == nil {
+		t.Fatalf("expected error for missing temp dir")
+	}
+	if _, err := TryNewIntWithOptions(opt); err == nil {
+		t.Fatalf("expected error for missing temp dir")
+	}
+	if _, err := TryNewUint32WithOptions(opt); err == nil {
+		t.Fatalf("expected error for missing temp dir")
+	}
+	if _, err := TryNewConcurrentDefault(opt); err == nil {
+		t.Fatalf("expected error for missing temp dir")
+	}
+	m := NewIntWithOptions(Options{InMemory: true})
+	m.SetString(1, "1")
+	m.SetFinished()
+	if _, err := MergeInt(MergeOptions[int]{Options: opt}, m); err == nil {
+		t.Fatalf("expected error for missing temp dir")
+	}
+}
+
+//Finish出错时临时文件同样会被删除，之后不能再Set
+func TestFinishErrorRemovesTempFile(t *testing.T) {
+	dir := t.TempDir()
+	m := NewDefaultWithOptions(Options{TempDir: dir})
+	m.SetString("1", "1")
+	//关闭临时文件模拟读取失败
+	m.storage.file.Close()
+	if err := m.Finish(); err == nil {
+		t.Fatalf("expected error when temp file can't be read")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("unexpected file count obtained; got %d want %d", len(entries), 0)
+	}
+	if err := m.Abort(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	if err := m.TrySet([]byte("2"), nil); !errors.Is(err, ErrAborted) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrAborted)
+	}
+
+	c := NewConcurrentInt(Options{TempDir: dir})
+	for i := 0; i < 1000; i++ {
+		c.Set(i, []byte("v"))
+	}
+	c.b.shards[0].m.storage.file.Close()
+	if _, err := c.Finish(); err == nil {
+		t.Fatalf("expected error when temp file can't be read")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("unexpected file count obtained; got %d want %d", len(entries), 0)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"strconv"
+	"testing"
+)
+
+var stringSink string
+
+func TestGetStringUnsafe(t *testing.T) {
+	for _, index := range []IndexType{IndexOpenAddressing, IndexMinimalPerfectHash} {
+		m := NewDefaultWithOptions(Options{InMemory: true, Index: index})
+		for i := 0; i < 1000; i++ {
+			m.SetString("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+		}
+		m.SetString("empty", "")
+		m.SetFinished()
+		k := "key123"
+		if val, exist := m.GetStringUnsafe(k); !exist || val != "value123" {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, "value123")
+		}
+		if val, exist := m.GetStringUnsafe("empty"); !exist || val != "" {
+			t.Fatalf("unexpected value obtained; got %q want %q", val, "")
+		}
+		if val, exist := m.GetString("key1000"); exist {
+			t.Fatalf("unexpected value obtained; got %q want nothing", val)
+		}
+		if raceEnabled {
+			continue
+		}
+		//键不需要转换为[]byte,GetString只为值分配内存,GetStringUnsafe不分配内存
+		if n := testing.AllocsPerRun(100, func() { stringSink, _ = m.GetString(k) }); n != 1 {
+			t.Fatalf("unexpected allocs obtained; got %v want %v", n, 1)
+		}
+		if n := testing.AllocsPerRun(100, func() { stringSink, _ = m.GetStringUnsafe(k) }); n != 0 {
+			t.Fatalf("unexpected allocs obtained; got %v want %v", n, 0)
+		}
+	}
+}
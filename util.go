@@ -6,38 +6,27 @@
 package noGcStaticMap
 
 import (
-	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
 )
 
-//创建用于读写的临时文件 同一程序中同时初始化，可能会产生时间相同的问题，需要保证文件名唯一
-func createTempFile(args ...string) (tempFileName string, tempFile *os.File, bw *bufio.Writer) {
-	var err error
-	if len(args) > 0 {
-		tempFileName = args[0] + ".NoGcStaticMap"
-		if fileExist(tempFileName){
-			err := os.Remove(tempFileName)
-			haserrPanic(err)
-		}
-		tempFile, err = os.Create(tempFileName)
-		haserrPanic(err)
-		return tempFileName, tempFile, bufio.NewWriterSize(tempFile, 40960)
+//创建用于读写的临时文件 dir为空时使用os.TempDir(),name为空时使用noGcStaticMap,name可以包含目录,为相对路径时位于dir中
+//文件名为name.进程号.随机数.NoGcStaticMap,由os.CreateTemp保证唯一，不会覆盖已有的文件，进程号用于CleanupTempFiles判断文件是否已被遗弃
+func createTempFile(dir, name string) (*os.File, error) {
+	if dir == "" {
+		dir = os.TempDir()
 	}
-	for {
-		tempFileName = strconv.Itoa(int(time.Now().UnixNano())) + ".NoGcStaticMap"
-		if fileExist(tempFileName) {
-			continue
-		} else {
-			tempFile, err = os.Create(tempFileName)
-			haserrPanic(err)
-			return tempFileName, tempFile,bufio.NewWriterSize(tempFile, 40960)
-		}
+	if name == "" {
+		name = "noGcStaticMap"
 	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	return os.CreateTemp(filepath.Dir(name), filepath.Base(name)+"."+strconv.Itoa(os.Getpid())+".*"+tempFileSuffix)
 }
 
 //检察文件是或者目录否存在
@@ -52,8 +41,6 @@ func haserrPanic(err error) bool {
 		_, file, line, _ := runtime.Caller(1)
 		file = file[strings.LastIndex(file, `/`)+1:]
 		panic(fmt.Sprintf("%v,第%v行,错误类型:%v", file, line, err))
-		return true
-	} else {
-		return false
 	}
+	return false
 }
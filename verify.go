@@ -0,0 +1,163 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/cespare/xxhash"
+)
+
+//Verify需要检查的内容
+type verifyTarget struct {
+	finished    bool
+	data        []byte
+	checksum    uint64
+	hasChecksum bool
+	len         int
+	dead        int
+	indexCount  int
+	//检查pos处的键值对是否越界，返回下一个键值对的位置以及索引中该键对应的位置
+	record func(pos int) (next, found int, exist bool, err error)
+}
+
+//检查data与索引是否一致 数据损坏时读取可能越界，此时把panic转换为ErrCorrupted
+func (t verifyTarget) verify() (err error) {
+	if !t.finished {
+		return ErrNotFinished
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrCorrupted, r)
+		}
+	}()
+	if t.hasChecksum && xxhash.Sum64(t.data) != t.checksum {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+	if t.indexCount != t.len {
+		return fmt.Errorf("%w: index has %d keys, want %d", ErrCorrupted, t.indexCount, t.len)
+	}
+	live, dead := 0, 0
+	for pos := 0; pos < len(t.data); {
+		next, found, exist, err := t.record(pos)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !exist:
+			return fmt.Errorf("%w: key of record at %d not found in index", ErrCorrupted, pos)
+		case found == pos:
+			live = live + 1
+		case found > pos:
+			//被DuplicateKeepLast覆盖的键值对，索引指向之后的同一个键
+			dead = dead + 1
+		default:
+			return fmt.Errorf("%w: index of key at %d points to earlier record at %d", ErrCorrupted, pos, found)
+		}
+		pos = next
+	}
+	if live != t.len || dead != t.dead {
+		return fmt.Errorf("%w: found %d live and %d dead records, want %d and %d", ErrCorrupted, live, dead, t.len, t.dead)
+	}
+	return nil
+}
+
+//键值对越界时的错误
+func errRecordOutOfBounds(pos int) error {
+	return fmt.Errorf("%w: record at %d is out of bounds", ErrCorrupted, pos)
+}
+
+//检查data与索引是否一致:遍历所有的键值对，检查长度是否越界，重新计算每个键的hash值并确认索引指向该键值对，
+//检查键值对个数是否与Len一致，从快照加载时还会检查data的校验和。SetFinished之前调用时返回ErrNotFinished
+func (n *NoGcStaticMapAny) Verify() error {
+	return verifyTarget{finished: n.setFinished, data: n.data, checksum: n.checksum, hasChecksum: n.hasChecksum,
+		len: n.len, dead: n.dead, indexCount: n.hashIndex.count(),
+		record: func(pos int) (next, found int, exist bool, err error) {
+			if pos+4 > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			keyLen := (int(n.data[pos]) << 8) | int(n.data[pos+1])
+			valLen := (int(n.data[pos+2]) << 8) | int(n.data[pos+3])
+			next = pos + 4 + keyLen + valLen
+			if next > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			found, exist = n.find(n.data[pos+4 : pos+4+keyLen])
+			return next, found, exist, nil
+		},
+	}.verify()
+}
+
+//检查data与索引是否一致 同NoGcStaticMapAny.Verify
+func (n *NoGcStaticMapHuge) Verify() error {
+	return verifyTarget{finished: n.setFinished, data: n.data, checksum: n.checksum, hasChecksum: n.hasChecksum,
+		len: n.len, dead: n.dead, indexCount: n.hashIndex.count(),
+		record: func(pos int) (next, found int, exist bool, err error) {
+			if pos+8 > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			keyLen := uint64(binary.LittleEndian.Uint32(n.data[pos : pos+4]))
+			valLen := uint64(binary.LittleEndian.Uint32(n.data[pos+4 : pos+8]))
+			if uint64(pos)+8+keyLen+valLen > uint64(len(n.data)) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			next = pos + 8 + int(keyLen) + int(valLen)
+			found, exist = n.find(n.data[pos+8 : pos+8+int(keyLen)])
+			return next, found, exist, nil
+		},
+	}.verify()
+}
+
+//检查data与索引是否一致 遍历所有的键值对，检查长度是否越界，确认索引中每个键都指向该键值对，
+//检查键值对个数是否与Len一致，从快照加载时还会检查data的校验和。SetFinished之前调用时返回ErrNotFinished
+func (n *NoGcStaticMapInt) Verify() error {
+	return verifyTarget{finished: n.setFinished, data: n.data, checksum: n.checksum, hasChecksum: n.hasChecksum,
+		len: n.len, dead: n.dead, indexCount: n.table.count(),
+		record: func(pos int) (next, found int, exist bool, err error) {
+			if pos+10 > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			valLen := (int(n.data[pos+8]) << 8) | int(n.data[pos+9])
+			next = pos + 10 + valLen
+			if next > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			found, exist = n.table.findExact(binary.LittleEndian.Uint64(n.data[pos : pos+8]))
+			return next, found, exist, nil
+		},
+	}.verify()
+}
+
+//检查data与索引是否一致 同NoGcStaticMapInt.Verify
+func (n *NoGcStaticMapUint32) Verify() error {
+	return verifyTarget{finished: n.setFinished, data: n.data, checksum: n.checksum, hasChecksum: n.hasChecksum,
+		len: n.len, dead: n.dead, indexCount: n.table.count(),
+		record: func(pos int) (next, found int, exist bool, err error) {
+			if pos+6 > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			valLen := (int(n.data[pos+4]) << 8) | int(n.data[pos+5])
+			next = pos + 6 + valLen
+			if next > len(n.data) {
+				return 0, 0, false, errRecordOutOfBounds(pos)
+			}
+			found, exist = n.table.findExact(uint64(binary.LittleEndian.Uint32(n.data[pos : pos+4])))
+			return next, found, exist, nil
+		},
+	}.verify()
+}
+
+//检查data与索引是否一致 同NoGcStaticMapHuge.Verify
+func (n *NoGcStaticMap[K, V]) Verify() error {
+	return n.m.Verify()
+}
+
+//检查base中data与索引是否一致 同NoGcStaticMapAny.Verify
+func (n *NoGcStaticMapOverlay) Verify() error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.base.Verify()
+}
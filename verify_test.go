@@ -0,0 +1,77 @@
+// Copyright 2022 rateLimit Author(https://github.com/yudeguang/noGcStaticMap). All Rights Reserved.
+//
+// This Source Code Form is subject to the terms of the MIT License.
+// If a copy of the MIT was not distributed with this file,
+// You can obtain one at https://github.com/yudeguang/noGcStaticMap.
+package noGcStaticMap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "mapAnyVerifyForTest.snapshot")
+	for _, index := range []IndexType{IndexOpenAddressing, IndexMinimalPerfectHash} {
+		m := NewDefaultWithOptions(Options{InMemory: true, Index: index, Duplicate: DuplicateKeepLast})
+		if err := m.Verify(); !errors.Is(err, ErrNotFinished) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrNotFinished)
+		}
+		for i := 0; i < 1000; i++ {
+			m.SetString(strconv.Itoa(i), strconv.Itoa(i))
+		}
+		//被覆盖的键值对也能通过检查
+		m.SetString("1", "one")
+		m.SetFinished()
+		if err := m.Verify(); err != nil {
+			t.Fatalf("unexpected error obtained; got %v want nil", err)
+		}
+		if err := m.SaveToFile(fileName); err != nil {
+			t.Fatalf("cannot save snapshot: %s", err)
+		}
+		//修改快照中data的内容，校验和不一致
+		b, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("cannot read snapshot: %s", err)
+		}
+		b[snapshotHeaderSize+4] ^= 1
+		if err = os.WriteFile(fileName, b, 0644); err != nil {
+			t.Fatalf("cannot write snapshot: %s", err)
+		}
+		loaded, err := LoadDefault(fileName)
+		if err != nil {
+			t.Fatalf("cannot load snapshot: %s", err)
+		}
+		if err = loaded.Verify(); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrCorrupted)
+		}
+		//没有校验和时也能通过索引发现键被修改
+		m.data[4] ^= 1
+		if err = m.Verify(); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("unexpected error obtained; got %v want %v", err, ErrCorrupted)
+		}
+	}
+}
+
+func TestVerifyInt(t *testing.T) {
+	m := NewIntWithOptions(Options{InMemory: true})
+	for i := 0; i < 1000; i++ {
+		m.SetString(i, strconv.Itoa(i))
+	}
+	m.SetFinished()
+	if err := m.Verify(); err != nil {
+		t.Fatalf("unexpected error obtained; got %v want nil", err)
+	}
+	//值的长度越界
+	m.data[len(m.data)-5] = 0xff
+	if err := m.Verify(); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrCorrupted)
+	}
+	m.len = m.len + 1
+	if err := m.Verify(); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("unexpected error obtained; got %v want %v", err, ErrCorrupted)
+	}
+}